@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/gilmae/monkey/token"
@@ -11,6 +12,7 @@ import (
 type Node interface {
 	String() string
 	TokenLiteral() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -42,6 +44,31 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// Exports returns the names a program exports when it is imported as a
+// module: those bound by its top-level let statements, except names
+// starting with an underscore, in the order they are first bound.
+func (p *Program) Exports() []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, s := range p.Statements {
+		let, ok := s.(*LetStatement)
+		if !ok || strings.HasPrefix(let.Name.Value, "_") || seen[let.Name.Value] {
+			continue
+		}
+		seen[let.Name.Value] = true
+		names = append(names, let.Name.Value)
+	}
+	return names
+}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -60,11 +87,16 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 
+// AssignStatement stores Value in the variable Name. Operator is empty for
+// a plain assignment and holds the binary operator of a compound one, so
+// x += 1 has Operator "+".
 type AssignStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token
+	Name     *Identifier
+	Operator string
+	Value    Expression
 }
 
 func (as *AssignStatement) expressionNode() {}
@@ -72,15 +104,39 @@ func (as *AssignStatement) expressionNode() {}
 // TokenLiteral returns the literal token.
 func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
 
+// Pos returns the position of the token.
+func (as *AssignStatement) Pos() token.Position { return as.Token.Pos }
+
 // String returns this object as a string.
 func (as *AssignStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(as.Name.String())
-	out.WriteString("=")
+	out.WriteString(as.Operator + "=")
 	out.WriteString(as.Value.String())
 	return out.String()
 }
 
+// IndexAssignStatement stores Value in the array or hash element named by
+// Target, as in arr[i] = v or h["a"][0] = v. Operator is set as for
+// AssignStatement.
+type IndexAssignStatement struct {
+	Token    token.Token
+	Target   *IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ias *IndexAssignStatement) expressionNode()      {}
+func (ias *IndexAssignStatement) TokenLiteral() string { return ias.Token.Literal }
+func (ias *IndexAssignStatement) Pos() token.Position  { return ias.Token.Pos }
+func (ias *IndexAssignStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ias.Target.String())
+	out.WriteString(ias.Operator + "=")
+	out.WriteString(ias.Value.String())
+	return out.String()
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -92,6 +148,7 @@ func (i *Identifier) String() string {
 }
 
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 
 type ReturnStatement struct {
 	Token       token.Token
@@ -109,6 +166,7 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 
 type ExpressionStatement struct {
 	Token      token.Token
@@ -124,6 +182,7 @@ func (es *ExpressionStatement) String() string {
 
 }
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -132,8 +191,19 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -142,6 +212,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -153,6 +224,35 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// IncrementExpression adds one to, or with --, subtracts one from a
+// variable or an array or hash element. The prefix form evaluates to the
+// updated value and the postfix form to the value before the update.
+type IncrementExpression struct {
+	Token    token.Token // the ++ or -- token
+	Target   Expression  // an *Identifier or *IndexExpression
+	Operator string      // "+" or "-"
+	Prefix   bool
+}
+
+func (ie *IncrementExpression) expressionNode()      {}
+func (ie *IncrementExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IncrementExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IncrementExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	if ie.Prefix {
+		out.WriteString(ie.Token.Literal)
+	}
+	out.WriteString(ie.Target.String())
+	if !ie.Prefix {
+		out.WriteString(ie.Token.Literal)
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token
 	Left     Expression
@@ -162,6 +262,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -181,6 +282,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -194,6 +296,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -217,6 +320,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -236,6 +340,7 @@ type FunctionLiteral struct {
 
 func (fs *FunctionLiteral) expressionNode()      {}
 func (fs *FunctionLiteral) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionLiteral) Pos() token.Position  { return fs.Token.Pos }
 func (fs *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -263,6 +368,7 @@ type CallExpression struct {
 
 func (cs *CallExpression) expressionNode()      {}
 func (cs *CallExpression) TokenLiteral() string { return cs.Token.Literal }
+func (cs *CallExpression) Pos() token.Position  { return cs.Token.Pos }
 func (cs *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -285,6 +391,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type ArrayLiteral struct {
@@ -294,6 +401,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -316,6 +424,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -334,6 +443,7 @@ type HashLiteral struct {
 
 func (o *HashLiteral) expressionNode()      {}
 func (o *HashLiteral) TokenLiteral() string { return o.Token.Literal }
+func (o *HashLiteral) Pos() token.Position  { return o.Token.Pos }
 func (o *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -355,6 +465,7 @@ type UseLiteral struct {
 
 func (ul *UseLiteral) expressionNode()      {}
 func (ul *UseLiteral) TokenLiteral() string { return ul.Token.Literal }
+func (ul *UseLiteral) Pos() token.Position  { return ul.Token.Pos }
 func (ul *UseLiteral) String() string {
 	var out bytes.Buffer
 
@@ -365,3 +476,119 @@ func (ul *UseLiteral) String() string {
 
 	return out.String()
 }
+
+// ImportExpression loads the module at Path and evaluates to a hash of its
+// exported bindings.
+type ImportExpression struct {
+	Token token.Token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + "(" + strconv.Quote(ie.Path) + ")"
+}
+
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString(" catch(")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+type ForStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for(")
+	out.WriteString(fs.Name.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+
+	"github.com/gilmae/monkey/token"
 )
 
 type Instructions []byte
 
 type Opcode byte
 
+// SourceMap maps the offset of each instruction to the position of the
+// source it was compiled from.
+type SourceMap map[int]token.Position
+
 const (
 	OpConstant Opcode = iota
 	OpAdd
@@ -42,6 +48,26 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpSetFree
+	OpGetLocalCell
+	OpGetFreeCell
+	OpTry
+	OpEndTry
+	OpThrow
+	OpIterator
+	OpIterNext
+	OpTailCall
+	OpImport
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+	OpSetIndex
+	OpDuplicatePair
 )
 
 type Definition struct {
@@ -81,6 +107,26 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:            {"OpClosure", []int{2, 1}},
 	OpGetFree:            {"OpGetFree", []int{1}},
 	OpCurrentClosure:     {"OpCurrentClosure", []int{}},
+	OpSetFree:            {"OpSetFree", []int{1}},
+	OpGetLocalCell:       {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:        {"OpGetFreeCell", []int{1}},
+	OpTry:                {"OpTry", []int{2}},
+	OpEndTry:             {"OpEndTry", []int{}},
+	OpThrow:              {"OpThrow", []int{}},
+	OpIterator:           {"OpIterator", []int{}},
+	OpIterNext:           {"OpIterNext", []int{}},
+	OpTailCall:           {"OpTailCall", []int{1}},
+	OpImport:             {"OpImport", []int{2, 2}},
+	OpMod:                {"OpMod", []int{}},
+	OpPow:                {"OpPow", []int{}},
+	OpBitAnd:             {"OpBitAnd", []int{}},
+	OpBitOr:              {"OpBitOr", []int{}},
+	OpBitXor:             {"OpBitXor", []int{}},
+	OpShiftLeft:          {"OpShiftLeft", []int{}},
+	OpShiftRight:         {"OpShiftRight", []int{}},
+	OpBitNot:             {"OpBitNot", []int{}},
+	OpSetIndex:           {"OpSetIndex", []int{}},
+	OpDuplicatePair:      {"OpDuplicatePair", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -156,6 +202,7 @@ func (ins Instructions) String() string {
 
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 
@@ -187,3 +234,13 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
+
+// Lookup returns the source position of the instruction containing offset.
+func (sm SourceMap) Lookup(offset int) (token.Position, bool) {
+	for i := offset; i >= 0; i-- {
+		if pos, ok := sm[i]; ok {
+			return pos, true
+		}
+	}
+	return token.Position{}, false
+}
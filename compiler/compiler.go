@@ -1,23 +1,51 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/gilmae/monkey/ast"
 	"github.com/gilmae/monkey/code"
 	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/parser"
+	"github.com/gilmae/monkey/token"
 )
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+
+	loops    []*loopContext
+	tryDepth int
+
+	// guardedCalls holds the positions of calls compiled inside a try
+	// block. They must keep their frame so the handler can catch a throw.
+	guardedCalls map[int]bool
+
+	// depth is the number of values the instructions emitted so far leave
+	// on the stack, above those of the enclosing frame
+	depth int
+}
+
+// loopContext records where a loop being compiled starts, which is where
+// continue jumps to, and the jumps emitted by break that need patching
+// with the position after the loop. depth is the stack depth on entry,
+// which break and continue pop back to.
+type loopContext struct {
+	start    int
+	breaks   []int
+	tryDepth int
+	depth    int
 }
 
 type Compiler struct {
@@ -27,6 +55,20 @@ type Compiler struct {
 	scopeIndex int
 
 	symbolTable *SymbolTable
+
+	// capabilities are the groups of builtins the program may use
+	capabilities object.Capability
+
+	// globals is the program's global symbol table, where imported
+	// modules are recorded
+	globals *SymbolTable
+
+	// importing lists the modules being compiled, outermost first, to
+	// detect import cycles
+	importing []string
+
+	// pos is the source position of the node currently being compiled
+	pos token.Position
 }
 
 type EmittedInstruction struct {
@@ -39,35 +81,58 @@ func New() *Compiler {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		sourceMap:           code.SourceMap{},
 	}
 
+	symbolTable := newBuiltinTable()
+	return &Compiler{
+		constants:    []object.Object{},
+		symbolTable:  symbolTable,
+		globals:      symbolTable,
+		scopes:       []CompilationScope{mainScope},
+		scopeIndex:   0,
+		capabilities: object.CapAll,
+	}
+}
+
+// newBuiltinTable returns a global symbol table defining only the builtins.
+func newBuiltinTable() *SymbolTable {
 	symbolTable := NewSymbolTable()
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
-	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
-	}
+	return symbolTable
 }
 
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
+	compiler.globals = s
 	compiler.constants = constants
 	return compiler
 }
 
+// SetCapabilities restricts the builtins the program may use. Using one
+// that needs a capability not in caps is a compile error.
+func (c *Compiler) SetCapabilities(caps object.Capability) {
+	c.capabilities = caps
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil && node.Pos().IsValid() {
+		outer := c.pos
+		c.pos = node.Pos()
+		defer func() { c.pos = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -77,6 +142,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.UseLiteral:
+		// The parser leaves out the body when it isn't allowed to read it
+		if node.Body == nil || c.capabilities&object.CapFilesystem == 0 {
+			return c.errorf(node.Pos(), "use is not available: it needs the %s capability", object.CapFilesystem)
+		}
+
 		for _, s := range node.Body.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -84,6 +154,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpNull)
+	case *ast.ImportExpression:
+		return c.compileImport(node)
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -92,6 +164,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+
 		if node.Operator == "<" || node.Operator == "<=" {
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -130,6 +206,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case ">=":
@@ -139,11 +229,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.errorf(node.Pos(), "unknown operator %s", node.Operator)
 		}
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
@@ -164,8 +257,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMinus)
 		case "!":
 			c.emit(code.OpBang)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
-			return fmt.Errorf("unknown operator: %s", node.Operator)
+			return c.errorf(node.Pos(), "unknown operator: %s", node.Operator)
 		}
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
@@ -175,34 +270,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		// Emit an OpJumpNotTruthy with a bogus value
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		depth := c.scopes[c.scopeIndex].depth
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBlockValue(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
 		jumpPos := c.emit(code.OpJump, 9999)
 
 		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+		c.scopes[c.scopeIndex].depth = depth
 
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlockValue(node.Alternative)
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
-
 		}
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+		c.scopes[c.scopeIndex].depth = depth + 1
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -223,10 +314,34 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
 
+	case *ast.AssignStatement:
+		symbol, err := c.resolve(node.Name)
+		if err != nil {
+			return err
+		}
+
+		if node.Operator != "" {
+			c.loadSymbols(symbol)
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if node.Operator != "" {
+			c.emit(compoundOperators[node.Operator])
+		}
+
+		if !c.storeSymbol(symbol) {
+			return c.errorf(node.Name.Pos(), "cannot assign to %s", node.Name.Value)
+		}
+
+		c.loadSymbols(symbol)
 	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
-		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+		symbol, err := c.resolve(node)
+		if err != nil {
+			return err
 		}
 
 		c.loadSymbols(symbol)
@@ -271,6 +386,36 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpIndex)
+	case *ast.IncrementExpression:
+		return c.compileIncrement(node)
+	case *ast.IndexAssignStatement:
+		err := c.Compile(node.Target.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Target.Index)
+		if err != nil {
+			return err
+		}
+
+		// A compound assignment reads the element through a copy of the
+		// collection and index, so neither is evaluated twice.
+		if node.Operator != "" {
+			c.emit(code.OpDuplicatePair)
+			c.emit(code.OpIndex)
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if node.Operator != "" {
+			c.emit(compoundOperators[node.Operator])
+		}
+
+		c.emit(code.OpSetIndex)
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -291,19 +436,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			c.emit(code.OpReturn)
 		}
+		c.markTailCalls()
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbols(s)
+			c.loadCell(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
@@ -314,6 +463,111 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		// Emit an OpTry with a bogus catch position
+		tryPos := c.emit(code.OpTry, 9999)
+		depth := c.scopes[c.scopeIndex].depth
+
+		c.scopes[c.scopeIndex].tryDepth++
+		err := c.compileBlockValue(node.Block)
+		c.scopes[c.scopeIndex].tryDepth--
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpEndTry)
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		catchPos := len(c.currentInstructions())
+		c.changeOperand(tryPos, catchPos)
+
+		// The VM pushes the caught value before jumping to the handler
+		c.scopes[c.scopeIndex].depth = depth + 1
+		symbol := c.symbolTable.Define(node.Param.Value)
+		c.storeSymbol(symbol)
+
+		err = c.compileBlockValue(node.Handler)
+		if err != nil {
+			return err
+		}
+
+		afterHandlerPos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterHandlerPos)
+		c.scopes[c.scopeIndex].depth = depth + 1
+	case *ast.WhileStatement:
+		loop := c.enterLoop()
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Emit an OpJumpNotTruthy with a bogus value
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+		loop.breaks = append(loop.breaks, exitPos)
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.start)
+
+		c.leaveLoop()
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIterator)
+
+		// The iterator is kept in a variable no identifier can name, so that
+		// nothing is left on the stack across the loop body
+		iterator := c.symbolTable.Define("$iterator")
+		c.storeSymbol(iterator)
+
+		loop := c.enterLoop()
+
+		c.loadSymbols(iterator)
+		c.emit(code.OpIterNext)
+
+		// Emit an OpJumpNotTruthy with a bogus value
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+		loop.breaks = append(loop.breaks, exitPos)
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.storeSymbol(symbol)
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.start)
+
+		c.leaveLoop()
+	case *ast.BreakStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+
+		depth := c.unwind(loop)
+		jumpPos := c.emit(code.OpJump, 9999)
+		loop.breaks = append(loop.breaks, jumpPos)
+		c.scopes[c.scopeIndex].depth = depth
+	case *ast.ContinueStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+
+		depth := c.unwind(loop)
+		c.emit(code.OpJump, loop.start)
+		c.scopes[c.scopeIndex].depth = depth
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
@@ -326,12 +580,84 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		pos := c.emit(code.OpCall, len(node.Arguments))
+		if c.scopes[c.scopeIndex].tryDepth > 0 {
+			if c.scopes[c.scopeIndex].guardedCalls == nil {
+				c.scopes[c.scopeIndex].guardedCalls = map[int]bool{}
+			}
+			c.scopes[c.scopeIndex].guardedCalls[pos] = true
+		}
+	}
+
+	return nil
+}
+
+// compileBlockValue compiles a block so that it leaves the value of its
+// last expression on the stack, or null if it has none. A block that ends
+// by returning never falls through, so it needs no value.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
 	}
 
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
 	return nil
 }
 
+func (c *Compiler) enterLoop() *loopContext {
+	loop := &loopContext{
+		start:    len(c.currentInstructions()),
+		tryDepth: c.scopes[c.scopeIndex].tryDepth,
+		depth:    c.scopes[c.scopeIndex].depth,
+	}
+
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+	return loop
+}
+
+// leaveLoop patches the jumps out of the innermost loop to the current
+// position.
+func (c *Compiler) leaveLoop() {
+	loops := c.scopes[c.scopeIndex].loops
+	loop := loops[len(loops)-1]
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	afterLoopPos := len(c.currentInstructions())
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, afterLoopPos)
+	}
+	c.scopes[c.scopeIndex].depth = loop.depth
+}
+
+func (c *Compiler) currentLoop(node ast.Node) (*loopContext, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, c.errorf(node.Pos(), "%s outside loop", node.TokenLiteral())
+	}
+	return loops[len(loops)-1], nil
+}
+
+// unwind prepares for a break or continue to jump out of the expressions
+// and try blocks it is nested in since loop began. It pops the values they
+// left on the stack and emits an OpEndTry for each try block, so that no
+// stale values or handlers are left behind. It returns the stack depth
+// from before the pops, which the code after the jump still sees.
+func (c *Compiler) unwind(loop *loopContext) int {
+	depth := c.scopes[c.scopeIndex].depth
+	for i := loop.depth; i < depth; i++ {
+		c.emit(code.OpPop)
+	}
+	for i := loop.tryDepth; i < c.scopes[c.scopeIndex].tryDepth; i++ {
+		c.emit(code.OpEndTry)
+	}
+	return depth
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -341,15 +667,62 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
+	if c.pos.IsValid() {
+		c.scopes[c.scopeIndex].sourceMap[pos] = c.pos
+	}
+
 	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].depth += stackEffect(op, operands)
 	return pos
 }
 
+// stackEffect returns how many values an instruction adds to the stack, or
+// removes when negative. Where control flow joins, the compiler sets the
+// depth itself.
+func stackEffect(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree,
+		code.OpCurrentClosure, code.OpGetLocalCell, code.OpGetFreeCell,
+		code.OpImport, code.OpIterNext:
+		// OpIterNext replaces the iterator with the next element and
+		// whether there was one
+		return 1
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpSetFree,
+		code.OpIndex, code.OpReturnValue, code.OpThrow:
+		return -1
+	case code.OpSetIndex:
+		return -2
+	case code.OpDuplicatePair:
+		return 2
+	case code.OpArray, code.OpHash, code.OpClosure:
+		return 1 - operands[len(operands)-1]
+	case code.OpCall, code.OpTailCall:
+		return -operands[0]
+	default:
+		return 0
+	}
+}
+
+// errorf returns a compile error prefixed with the source position it
+// relates to.
+func (c *Compiler) errorf(pos token.Position, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if pos.IsValid() {
+		msg = fmt.Sprintf("%s: %s", pos, msg)
+	}
+	return errors.New(msg)
+}
+
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		sourceMap:           code.SourceMap{},
 	}
 
 	c.scopes = append(c.scopes, scope)
@@ -366,6 +739,230 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// compoundOperators maps the operator of a compound assignment such as +=
+// to the instruction that combines the old value with the new one.
+var compoundOperators = map[string]code.Opcode{
+	"+": code.OpAdd,
+	"-": code.OpSub,
+	"*": code.OpMul,
+	"/": code.OpDiv,
+	"%": code.OpMod,
+}
+
+// compileIncrement compiles ++ and --. The prefix forms are compound
+// assignments of 1. The postfix forms leave the old value on the stack
+// instead, which for an element is kept in a hidden variable while the
+// new value is stored.
+func (c *Compiler) compileIncrement(node *ast.IncrementExpression) error {
+	one := &ast.IntegerLiteral{Token: node.Token, Value: 1}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		if node.Prefix {
+			return c.Compile(&ast.AssignStatement{Token: node.Token, Name: target, Operator: node.Operator, Value: one})
+		}
+
+		symbol, err := c.resolve(target)
+		if err != nil {
+			return err
+		}
+
+		c.loadSymbols(symbol)
+		c.loadSymbols(symbol)
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+		c.emit(compoundOperators[node.Operator])
+
+		if !c.storeSymbol(symbol) {
+			return c.errorf(target.Pos(), "cannot assign to %s", target.Value)
+		}
+	case *ast.IndexExpression:
+		if node.Prefix {
+			return c.Compile(&ast.IndexAssignStatement{Token: node.Token, Target: target, Operator: node.Operator, Value: one})
+		}
+
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpDuplicatePair)
+		c.emit(code.OpIndex)
+
+		old := c.temporary()
+		c.storeSymbol(old)
+		c.loadSymbols(old)
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+		c.emit(compoundOperators[node.Operator])
+		c.emit(code.OpSetIndex)
+		c.emit(code.OpPop)
+		c.loadSymbols(old)
+	default:
+		return c.errorf(node.Pos(), "cannot apply %s to %s", node.Token.Literal, node.Target.String())
+	}
+
+	return nil
+}
+
+// temporaryName is the hidden variable returned by temporary. It can't
+// clash with a program's names, which are identifiers.
+const temporaryName = "(temporary)"
+
+// temporary returns a hidden variable in the current scope for holding a
+// value between instructions, defining it on first use.
+func (c *Compiler) temporary() Symbol {
+	if symbol, ok := c.symbolTable.store[temporaryName]; ok {
+		return symbol
+	}
+	return c.symbolTable.Define(temporaryName)
+}
+
+// compileLogical compiles && and || so that the right operand is only
+// evaluated when the left one doesn't decide the result. Both produce a
+// boolean.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	// Emit jumps with bogus targets, patched once the targets are known
+	leftPos := c.emit(code.OpJumpNotTruthy, 9999)
+	depth := c.scopes[c.scopeIndex].depth
+
+	leftTruePos := -1
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		leftTruePos = c.emit(code.OpJump, 9999)
+		c.changeOperand(leftPos, len(c.currentInstructions()))
+		c.scopes[c.scopeIndex].depth = depth
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	rightPos := c.emit(code.OpJumpNotTruthy, 9999)
+	c.emit(code.OpTrue)
+	endPos := c.emit(code.OpJump, 9999)
+
+	falsePos := len(c.currentInstructions())
+	c.changeOperand(rightPos, falsePos)
+	if leftTruePos == -1 {
+		c.changeOperand(leftPos, falsePos)
+	}
+	c.scopes[c.scopeIndex].depth = depth
+	c.emit(code.OpFalse)
+
+	afterPos := len(c.currentInstructions())
+	c.changeOperand(endPos, afterPos)
+	if leftTruePos != -1 {
+		c.changeOperand(leftTruePos, afterPos)
+	}
+
+	return nil
+}
+
+// compileImport compiles the module an import names, unless it already has
+// been, into a function that returns a hash of the module's exports. The
+// VM runs the function the first time the import is reached and caches the
+// hash in a global.
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+	if c.capabilities&object.CapFilesystem == 0 {
+		return c.errorf(node.Pos(), "import is not available: it needs the %s capability", object.CapFilesystem)
+	}
+
+	path, err := parser.FindModule(node.Path, node.Pos().File)
+	if err != nil {
+		return c.errorf(node.Pos(), "cannot import %q: %s", node.Path, err)
+	}
+
+	if m, ok := c.globals.modules[path]; ok {
+		c.emit(code.OpImport, m.constant, m.global)
+		return nil
+	}
+
+	for i, importing := range c.importing {
+		if importing == path {
+			cycle := append(append([]string{}, c.importing[i:]...), path)
+			return c.errorf(node.Pos(), "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, err := parser.ParseFile(path)
+	if err != nil {
+		return c.errorf(node.Pos(), "cannot import %q:\n%s", node.Path, err)
+	}
+
+	// Modules only see the builtins, not the globals of the importer
+	outer := c.symbolTable
+	c.enterScope()
+	c.symbolTable = NewEnclosedSymbolTable(newBuiltinTable())
+	c.importing = append(c.importing, path)
+
+	for _, s := range program.Statements {
+		err = c.Compile(s)
+		if err != nil {
+			break
+		}
+	}
+
+	c.importing = c.importing[:len(c.importing)-1]
+	if err != nil {
+		c.leaveScope()
+		c.symbolTable = outer
+		return err
+	}
+
+	exports := program.Exports()
+	for _, name := range exports {
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.loadSymbols(symbol)
+	}
+	c.emit(code.OpHash, len(exports)*2)
+	c.emit(code.OpReturnValue)
+
+	numLocals := c.symbolTable.numDefinitions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+	c.symbolTable = outer
+
+	fn := &object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		Name:         path,
+		SourceMap:    sourceMap,
+	}
+
+	m := c.globals.defineModule(path, c.addConstant(fn))
+	c.emit(code.OpImport, m.constant, m.global)
+	return nil
+}
+
+// resolve looks up the symbol an identifier refers to, checking that the
+// program has the capability any builtin it names needs.
+func (c *Compiler) resolve(ident *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return symbol, c.errorf(ident.Pos(), "undefined variable %s", ident.Value)
+	}
+
+	if symbol.Scope == BuiltinScope {
+		needed := object.BuiltinCapability(ident.Value)
+		if c.capabilities&needed != needed {
+			return symbol, c.errorf(ident.Pos(), "%s is not available: it needs the %s capability", ident.Value, needed)
+		}
+	}
+
+	return symbol, nil
+}
+
 func (c *Compiler) loadSymbols(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -381,6 +978,36 @@ func (c *Compiler) loadSymbols(s Symbol) {
 	}
 }
 
+// loadCell pushes the cell holding a symbol's value, rather than the value
+// itself, so that a closure capturing the symbol shares it with the
+// enclosing scope.
+func (c *Compiler) loadCell(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbols(s)
+	}
+}
+
+// storeSymbol emits the instruction that sets s to the value on top of the
+// stack, reporting false if s cannot be assigned to.
+func (c *Compiler) storeSymbol(s Symbol) bool {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	default:
+		return false
+	}
+	return true
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -412,9 +1039,54 @@ func (c *Compiler) removeLastPop() {
 
 	old := c.currentInstructions()
 	new := old[:last.Position]
+	delete(c.scopes[c.scopeIndex].sourceMap, last.Position)
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].depth++
+}
+
+// markTailCalls turns every call in the current scope whose result is
+// returned straight away, either directly or through a chain of jumps,
+// into an OpTailCall so the VM can reuse the caller's frame. Calls inside a
+// try block are never marked, even when returned, since reusing the frame
+// would drop the handler.
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+	guarded := c.scopes[c.scopeIndex].guardedCalls
+
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		if op == code.OpCall && !guarded[i] && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+
+		i = next
+	}
+}
+
+// returnsAt reports whether execution starting at pos returns the value on
+// top of the stack without doing anything else.
+func returnsAt(ins code.Instructions, pos int) bool {
+	for hops := 0; pos < len(ins) && hops < len(ins); hops++ {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
+		}
+	}
+	return false
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -2,6 +2,9 @@ package compiler
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gilmae/monkey/code"
@@ -60,6 +63,242 @@ func TestArrayLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestAssignStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let x = 1;
+			x = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let x = 1;
+				x = 2;
+			}
+			`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a) {
+				fn() { a = 2; }
+			}
+			`,
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestAssignStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "1:1: undefined variable x"},
+		{"let a = 1;\n len = 1", "2:2: cannot assign to len"},
+		{"y += 1", "1:1: undefined variable y"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error, want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] += 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDuplicatePair),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let x = 10;
+				x %= 3;
+			}
+			`,
+			expectedConstants: []interface{}{
+				10,
+				3,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMod),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; ++x;",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x--;",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0]++;",
+			expectedConstants: []interface{}{1, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDuplicatePair),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -197,7 +436,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -228,7 +467,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -258,13 +497,13 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -308,15 +547,15 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -342,7 +581,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalCell, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -421,6 +660,102 @@ func TestCompilerScopes(t *testing.T) {
 	}
 }
 
+func TestIntegerOperators(t *testing.T) {
+	operators := []struct {
+		operator string
+		opcode   code.Opcode
+	}{
+		{"%", code.OpMod},
+		{"**", code.OpPow},
+		{"&", code.OpBitAnd},
+		{"|", code.OpBitOr},
+		{"^", code.OpBitXor},
+		{"<<", code.OpShiftLeft},
+		{">>", code.OpShiftRight},
+	}
+
+	tests := []compilerTestCase{
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	for _, op := range operators {
+		tests = append(tests, compilerTestCase{
+			input:             fmt.Sprintf("1 %s 2", op.operator),
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(op.opcode),
+				code.Make(code.OpPop),
+			},
+		})
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `true && false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `true || false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 17),
+				// 0008
+				code.Make(code.OpFalse),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0012
+				code.Make(code.OpTrue),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpFalse),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -955,6 +1290,108 @@ func TestLetStatementScopes(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(n, f, g) { if (n) { f(n) } else { return g(); } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 14),
+					// 0005
+					code.Make(code.OpGetLocal, 1),
+					// 0007
+					code.Make(code.OpGetLocal, 0),
+					// 0009
+					code.Make(code.OpTailCall, 1),
+					// 0011
+					code.Make(code.OpJump, 19),
+					// 0014
+					code.Make(code.OpGetLocal, 2),
+					// 0016
+					code.Make(code.OpTailCall, 0),
+					// 0018
+					code.Make(code.OpReturnValue),
+					// 0019
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { let x = f(); try { f() } catch (e) { 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpCall, 0),
+					// 0004
+					code.Make(code.OpSetLocal, 1),
+					// 0006
+					code.Make(code.OpTry, 17),
+					// 0009
+					code.Make(code.OpGetLocal, 0),
+					// 0011
+					code.Make(code.OpCall, 0),
+					// 0013
+					code.Make(code.OpEndTry),
+					// 0014
+					code.Make(code.OpJump, 22),
+					// 0017
+					code.Make(code.OpSetLocal, 2),
+					// 0019
+					code.Make(code.OpConstant, 0),
+					// 0022
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(g) { try { return g(); } catch (e) { 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 12),
+					// 0003
+					code.Make(code.OpGetLocal, 0),
+					// 0005
+					code.Make(code.OpCall, 0),
+					// 0007
+					code.Make(code.OpReturnValue),
+					// 0008
+					code.Make(code.OpEndTry),
+					// 0009
+					code.Make(code.OpJump, 17),
+					// 0012
+					code.Make(code.OpSetLocal, 1),
+					// 0014
+					code.Make(code.OpConstant, 0),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestRecusiveFunnctionns(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -969,7 +1406,7 @@ func TestRecusiveFunnctionns(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -998,7 +1435,7 @@ func TestRecusiveFunnctionns(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -1007,7 +1444,7 @@ func TestRecusiveFunnctionns(t *testing.T) {
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -1024,6 +1461,40 @@ func TestRecusiveFunnctionns(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSourceMap(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+  x + a
+};`
+
+	program := parse(input)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error, %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	// OpConstant 0 at offset 0 comes from the literal 1 on line 1
+	pos, ok := bytecode.SourceMap.Lookup(0)
+	if !ok || pos.Line != 1 || pos.Column != 9 {
+		t.Errorf("wrong position for offset 0, got %s", pos)
+	}
+
+	fn, ok := bytecode.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 not a function: %T", bytecode.Constants[1])
+	}
+
+	// OpAdd at offset 5 comes from the + on line 3
+	pos, ok = fn.SourceMap.Lookup(5)
+	if !ok || pos.Line != 3 || pos.Column != 5 {
+		t.Errorf("wrong position for OpAdd, got %s", pos)
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1048,6 +1519,134 @@ func TestStringExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1 } catch (e) { e }; throw 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 16),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpConstant, 1),
+				// 0020
+				code.Make(code.OpThrow),
+			},
+		},
+		{
+			input:             "try { } catch (e) { }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 8),
+				// 0003
+				code.Make(code.OpNull),
+				// 0004
+				code.Make(code.OpEndTry),
+				// 0005
+				code.Make(code.OpJump, 12),
+				// 0008
+				code.Make(code.OpSetGlobal, 0),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { 1; break; continue; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 17),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 17),
+				// 0011
+				code.Make(code.OpJump, 0),
+				// 0014
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIterator),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpIterNext),
+				// 0014
+				code.Make(code.OpJumpNotTruthy, 27),
+				// 0017
+				code.Make(code.OpSetGlobal, 1),
+				// 0020
+				code.Make(code.OpGetGlobal, 1),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpJump, 10),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "1:1: break outside loop"},
+		{"while (true) { fn() { continue } }", "1:23: continue outside loop"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error, want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
 func TestUseExpression(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1194,3 +1793,139 @@ func testInstructions(
 
 	return nil
 }
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		caps     object.Capability
+		expected string
+	}{
+		{`open("data.txt")`, object.CapAll, ""},
+		{`open("data.txt")`, object.CapProcess, `1:1: open is not available: it needs the filesystem capability`},
+		{`let f = fn() { exit(1) }`, object.CapFilesystem, `1:16: exit is not available: it needs the process capability`},
+		{`getenv = 1`, object.CapNone, `1:1: getenv is not available: it needs the environment capability`},
+		{`import("secret")`, object.CapProcess, `1:1: import is not available: it needs the filesystem capability`},
+		{`puts(path_join("a", "b"), len([]))`, object.CapNone, ""},
+		{`let open = fn(x) { x }; open(1)`, object.CapNone, ""},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		compiler.SetCapabilities(tt.caps)
+		err := compiler.Compile(program)
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error, want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestUseNeedsFilesystem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(path, []byte("let x = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := `use("` + path + `")`
+	expected := "1:1: use is not available: it needs the filesystem capability"
+
+	compiler := New()
+	compiler.SetCapabilities(object.CapProcess)
+	err := compiler.Compile(parse(input))
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong compiler error, want=%q, got=%v", expected, err)
+	}
+
+	p := parser.New(lexer.New(input))
+	p.DisableFileAccess()
+	program := p.ParseProgram()
+	if use := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.UseLiteral); use.Body != nil {
+		t.Fatalf("use() read %s with file access disabled", path)
+	}
+
+	err = New().Compile(program)
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong compiler error, want=%q, got=%v", expected, err)
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.mk":    `let b = import("b")`,
+		"b.mk":    `let a = import("a")`,
+		"self.mk": `import("self")`,
+		"bad.mk":  `let = 1`,
+		"lib.mk":  `let x = 1`,
+		"uses.mk": `let y = x`,
+	}
+	for name, source := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	main := filepath.Join(dir, "main.mk")
+	a, b, self := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk"), filepath.Join(dir, "self.mk")
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("missing")`, `cannot import "missing": module not found: missing.mk`},
+		{`import("a")`, fmt.Sprintf("import cycle: %s -> %s -> %s", a, b, a)},
+		{`import("self")`, fmt.Sprintf("import cycle: %s -> %s", self, self)},
+		{`import("bad")`, `cannot import "bad":`},
+		{`let x = 1; import("uses")`, "undefined variable x"},
+	}
+
+	for _, tt := range errorTests {
+		program := parseFile(tt.input, main)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error for %q", tt.input)
+		}
+
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error, want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+
+	program := parseFile(`let m = import("lib"); let n = import("./lib.mk"); fn() { import("lib") }`, main)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	modules := 0
+	for _, constant := range compiler.Bytecode().Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && fn.Name == filepath.Join(dir, "lib.mk") {
+			modules++
+		}
+	}
+	if modules != 1 {
+		t.Errorf("module compiled %d times, want 1", modules)
+	}
+}
+
+func parseFile(input string, filename string) *ast.Program {
+	l := lexer.NewWithFilename(input, filename)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
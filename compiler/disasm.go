@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gilmae/monkey/code"
+	"github.com/gilmae/monkey/object"
+)
+
+// Disassemble writes a readable listing of the bytecode: the main program,
+// the constant pool and the instructions of every compiled function in it.
+func Disassemble(out io.Writer, b *Bytecode) {
+	numFree := closureFreeCounts(b)
+
+	fmt.Fprintf(out, "== main ==\n%s", b.Instructions)
+
+	if len(b.Constants) > 0 {
+		fmt.Fprintf(out, "\n== constants ==\n")
+	}
+	for i, c := range b.Constants {
+		if _, ok := c.(*object.CompiledFunction); ok {
+			continue
+		}
+		fmt.Fprintf(out, "%04d %s %s\n", i, c.Type(), c.Inspect())
+	}
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+
+		fmt.Fprintf(out, "\n== constant %d: fn %s (params=%d, locals=%d, free=%d) ==\n%s",
+			i, name, fn.NumParameters, fn.NumLocals, numFree[i], fn.Instructions)
+	}
+}
+
+// closureFreeCounts finds the number of free variables each compiled
+// function closes over. It isn't stored on the function itself, only in the
+// OpClosure instructions that create it.
+func closureFreeCounts(b *Bytecode) map[int]int {
+	counts := map[int]int{}
+
+	scan := func(ins code.Instructions) {
+		for i := 0; i < len(ins); {
+			def, err := code.Lookup(ins[i])
+			if err != nil {
+				return
+			}
+
+			operands, read := code.ReadOperands(def, ins[i+1:])
+			if code.Opcode(ins[i]) == code.OpClosure {
+				counts[operands[0]] = operands[1]
+			}
+
+			i += 1 + read
+		}
+	}
+
+	scan(b.Instructions)
+	for _, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			scan(fn.Instructions)
+		}
+	}
+
+	return counts
+}
@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let a = 1; let f = fn(x) { fn() { x + a } };`
+
+	program := parse(input)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `== main ==
+0000 OpConstant 0
+0003 OpSetGlobal 0
+0006 OpClosure 2 0
+0010 OpSetGlobal 1
+
+== constants ==
+0000 INTEGER 1
+
+== constant 1: fn <anonymous> (params=0, locals=0, free=1) ==
+0000 OpGetFree 0
+0002 OpGetGlobal 0
+0005 OpAdd
+0006 OpReturnValue
+
+== constant 2: fn f (params=1, locals=1, free=0) ==
+0000 OpGetLocalCell 0
+0002 OpClosure 1 1
+0006 OpReturnValue
+`
+
+	var out bytes.Buffer
+	Disassemble(&out, compiler.Bytecode())
+
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,261 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gilmae/monkey/code"
+	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/token"
+)
+
+// Magic is the header every compiled Monkey file starts with.
+var Magic = []byte("MKC\x00")
+
+// FormatVersion is bumped whenever the encoding or the instruction set
+// changes in a way older files can't be run with.
+const FormatVersion = 2
+
+// Tags identifying the type of each entry in the constant pool.
+const (
+	tagInteger byte = iota
+	tagFloat
+	tagString
+	tagFunction
+)
+
+// IsCompiled reports whether data looks like serialized bytecode.
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// MarshalBinary encodes the bytecode as a header followed by the
+// instructions, source map and constant pool.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	w := &bytecodeWriter{}
+	w.buf.Write(Magic)
+	w.writeUint16(FormatVersion)
+
+	w.writeInstructions(b.Instructions, b.SourceMap)
+
+	w.writeUint32(len(b.Constants))
+	for i, c := range b.Constants {
+		err := w.writeConstant(c)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %s", i, err)
+		}
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes bytecode produced by MarshalBinary.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsCompiled(data) {
+		return fmt.Errorf("not a compiled monkey file")
+	}
+
+	r := &bytecodeReader{data: data, pos: len(Magic)}
+	version := r.readUint16()
+	if r.err == nil && version != FormatVersion {
+		return fmt.Errorf("unsupported bytecode version: want=%d, got=%d", FormatVersion, version)
+	}
+
+	instructions, sourceMap := r.readInstructions()
+
+	count := r.readUint32()
+	var constants []object.Object
+	for i := 0; i < count && r.err == nil; i++ {
+		constants = append(constants, r.readConstant())
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	b.Instructions = instructions
+	b.SourceMap = sourceMap
+	b.Constants = constants
+	return nil
+}
+
+// Unmarshal decodes bytecode produced by Bytecode.MarshalBinary.
+func Unmarshal(data []byte) (*Bytecode, error) {
+	b := &Bytecode{}
+	err := b.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type bytecodeWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *bytecodeWriter) writeUint16(n int) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(n))
+	w.buf.Write(b[:])
+}
+
+func (w *bytecodeWriter) writeUint32(n int) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	w.buf.Write(b[:])
+}
+
+func (w *bytecodeWriter) writeUint64(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	w.buf.Write(b[:])
+}
+
+func (w *bytecodeWriter) writeString(s string) {
+	w.writeUint32(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *bytecodeWriter) writeInstructions(ins code.Instructions, sourceMap code.SourceMap) {
+	w.writeUint32(len(ins))
+	w.buf.Write(ins)
+
+	offsets := make([]int, 0, len(sourceMap))
+	for offset := range sourceMap {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+
+	w.writeUint32(len(offsets))
+	for _, offset := range offsets {
+		pos := sourceMap[offset]
+		w.writeUint32(offset)
+		w.writeString(pos.File)
+		w.writeUint32(pos.Line)
+		w.writeUint32(pos.Column)
+	}
+}
+
+func (w *bytecodeWriter) writeConstant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		w.buf.WriteByte(tagInteger)
+		w.writeUint64(uint64(obj.Value))
+	case *object.Float:
+		w.buf.WriteByte(tagFloat)
+		w.writeUint64(math.Float64bits(obj.Value))
+	case *object.String:
+		w.buf.WriteByte(tagString)
+		w.writeString(obj.Value)
+	case *object.CompiledFunction:
+		w.buf.WriteByte(tagFunction)
+		w.writeString(obj.Name)
+		w.writeUint32(obj.NumLocals)
+		w.writeUint32(obj.NumParameters)
+		w.writeInstructions(obj.Instructions, obj.SourceMap)
+	default:
+		return fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+	return nil
+}
+
+// bytecodeReader decodes serialized bytecode. The first error it meets is
+// kept in err and every later read returns a zero value.
+type bytecodeReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bytecodeReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of bytecode at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *bytecodeReader) readByte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *bytecodeReader) readUint16() int {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (r *bytecodeReader) readUint32() int {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+func (r *bytecodeReader) readUint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *bytecodeReader) readString() string {
+	return string(r.next(r.readUint32()))
+}
+
+func (r *bytecodeReader) readInstructions() (code.Instructions, code.SourceMap) {
+	ins := code.Instructions(append([]byte{}, r.next(r.readUint32())...))
+
+	sourceMap := code.SourceMap{}
+	count := r.readUint32()
+	for i := 0; i < count && r.err == nil; i++ {
+		offset := r.readUint32()
+		pos := token.Position{File: r.readString()}
+		pos.Line = r.readUint32()
+		pos.Column = r.readUint32()
+		sourceMap[offset] = pos
+	}
+
+	return ins, sourceMap
+}
+
+func (r *bytecodeReader) readConstant() object.Object {
+	tag := r.readByte()
+	if r.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: int64(r.readUint64())}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(r.readUint64())}
+	case tagString:
+		return &object.String{Value: r.readString()}
+	case tagFunction:
+		fn := &object.CompiledFunction{Name: r.readString()}
+		fn.NumLocals = r.readUint32()
+		fn.NumParameters = r.readUint32()
+		fn.Instructions, fn.SourceMap = r.readInstructions()
+		return fn
+	default:
+		r.err = fmt.Errorf("unknown constant tag %d", tag)
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let name = "monkey";
+	let scale = 1.5;
+	let add = fn(a, b) { let c = a + b; c * scale };
+	add(1, 2);
+	`
+
+	program := parse(input)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	if !IsCompiled(data) {
+		t.Fatalf("serialized bytecode does not start with the magic header")
+	}
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(bytecode, decoded) {
+		t.Errorf("decoded bytecode differs.\nwant=%+v\ngot =%+v", bytecode, decoded)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	program := parse(`fn(x) { x + 1 }(2)`)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	data, err := compiler.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	badVersion := append([]byte{}, data...)
+	badVersion[len(Magic)+1] = FormatVersion + 1
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled monkey file"},
+		{badVersion, fmt.Sprintf("unsupported bytecode version: want=%d, got=%d", FormatVersion, FormatVersion+1)},
+		{data[:len(data)-3], "unexpected end of bytecode at offset"},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal(tt.data)
+		if err == nil {
+			t.Fatalf("expected error %q, got none", tt.expected)
+		}
+
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
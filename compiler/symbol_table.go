@@ -1,5 +1,10 @@
 package compiler
 
+import (
+	"sort"
+	"strconv"
+)
+
 type SymbolScope string
 
 const (
@@ -21,6 +26,17 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+
+	// modules maps the path of each module compiled against a global
+	// table to where it is kept
+	modules map[string]module
+}
+
+// module records the constant holding a compiled module's function and the
+// global its value is cached in once it has run.
+type module struct {
+	constant int
+	global   int
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -37,6 +53,42 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// Copy returns a table with the same definitions as s, so that compiling
+// against the copy leaves s unchanged.
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+		modules:        make(map[string]module, len(s.modules)),
+	}
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+	for path, m := range s.modules {
+		c.modules[path] = m
+	}
+	return c
+}
+
+// Symbols returns the symbols defined directly in s, ordered by scope and
+// index.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Scope != symbols[j].Scope {
+			return symbols[i].Scope < symbols[j].Scope
+		}
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
@@ -62,6 +114,20 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	return symbol
 }
 
+// defineModule reserves a global to cache the value of the module at path,
+// whose function is the constant at index constant. The global's name
+// can't clash with an identifier.
+func (s *SymbolTable) defineModule(path string, constant int) module {
+	if s.modules == nil {
+		s.modules = make(map[string]module)
+	}
+
+	symbol := s.Define("import(" + strconv.Quote(path) + ")")
+	m := module{constant: constant, global: symbol.Index}
+	s.modules[path] = m
+	return m
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -333,3 +333,33 @@ func TestResolveNestedLocal(t *testing.T) {
 		}
 	}
 }
+
+func TestCopySymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+
+	copied := global.Copy()
+	copied.Define("b")
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("defining in the copy changed the original")
+	}
+
+	expected := []Symbol{
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: GlobalScope, Index: 1},
+	}
+
+	symbols := copied.Symbols()
+	if len(symbols) != len(expected) {
+		t.Fatalf("wrong number of symbols. want=%d, got=%d", len(expected), len(symbols))
+	}
+
+	for i, sym := range expected {
+		if symbols[i] != sym {
+			t.Errorf("symbol %d wrong. want=%+v, got=%+v", i, sym, symbols[i])
+		}
+	}
+}
@@ -19,4 +19,48 @@ var builtins = map[string]*object.Builtin{
 	"set":   object.GetBuiltinByName("set"),
 	"int":   object.GetBuiltinByName("int"),
 	"exit":  object.GetBuiltinByName("exit"),
+	"float": object.GetBuiltinByName("float"),
+	"round": object.GetBuiltinByName("round"),
+
+	"split":       object.GetBuiltinByName("split"),
+	"join":        object.GetBuiltinByName("join"),
+	"trim":        object.GetBuiltinByName("trim"),
+	"replace":     object.GetBuiltinByName("replace"),
+	"contains":    object.GetBuiltinByName("contains"),
+	"index_of":    object.GetBuiltinByName("index_of"),
+	"upper":       object.GetBuiltinByName("upper"),
+	"lower":       object.GetBuiltinByName("lower"),
+	"starts_with": object.GetBuiltinByName("starts_with"),
+	"ends_with":   object.GetBuiltinByName("ends_with"),
+	"substr":      object.GetBuiltinByName("substr"),
+	"repeat":      object.GetBuiltinByName("repeat"),
+
+	"json_parse":     object.GetBuiltinByName("json_parse"),
+	"json_stringify": object.GetBuiltinByName("json_stringify"),
+
+	"write":      object.GetBuiltinByName("write"),
+	"writeln":    object.GetBuiltinByName("writeln"),
+	"flush":      object.GetBuiltinByName("flush"),
+	"seek":       object.GetBuiltinByName("seek"),
+	"read_bytes": object.GetBuiltinByName("read_bytes"),
+
+	"exists":    object.GetBuiltinByName("exists"),
+	"stat":      object.GetBuiltinByName("stat"),
+	"list_dir":  object.GetBuiltinByName("list_dir"),
+	"mkdir":     object.GetBuiltinByName("mkdir"),
+	"remove":    object.GetBuiltinByName("remove"),
+	"rename":    object.GetBuiltinByName("rename"),
+	"glob":      object.GetBuiltinByName("glob"),
+	"path_join": object.GetBuiltinByName("path_join"),
+	"basename":  object.GetBuiltinByName("basename"),
+	"dirname":   object.GetBuiltinByName("dirname"),
+	"ext":       object.GetBuiltinByName("ext"),
+
+	"args":    object.GetBuiltinByName("args"),
+	"getenv":  object.GetBuiltinByName("getenv"),
+	"setenv":  object.GetBuiltinByName("setenv"),
+	"environ": object.GetBuiltinByName("environ"),
+
+	"map":  object.GetBuiltinByName("map"),
+	"sort": object.GetBuiltinByName("sort"),
 }
@@ -2,15 +2,22 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"strings"
 
 	"github.com/gilmae/monkey/ast"
 	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/parser"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -66,6 +73,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
@@ -73,6 +83,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Identifier:
 		return evalIdentifer(node, env)
 
@@ -85,13 +97,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		env.Set(node.Name.Value, val)
 	case *ast.AssignStatement:
+		var current object.Object
+		if node.Operator != "" {
+			current = evalIdentifer(node.Name, env)
+			if isError(current) {
+				return current
+			}
+		}
+
 		val := Eval(node.Value, env)
 
 		if isError(val) {
 			return val
 		}
 
+		if node.Operator != "" {
+			val = evalInfixExpression(node.Operator, current, val)
+			if isError(val) {
+				return val
+			}
+		}
+
 		env.Set(node.Name.Value, val)
+	case *ast.IndexAssignStatement:
+		return evalIndexAssignment(node, env)
+	case *ast.IncrementExpression:
+		return evalIncrementExpression(node, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -111,6 +142,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.String{Value: node.Value}
 	case *ast.UseLiteral:
 		return evalProgram(node.Body, env)
+	case *ast.ImportExpression:
+		return evalImport(node)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+
+		if isError(val) {
+			return val
+		}
+		return evalThrow(val)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	}
 	return nil
@@ -121,9 +171,21 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	case *object.Function:
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+		if evaluated == BREAK || evaluated == CONTINUE {
+			return newError("%s outside loop", evaluated.Inspect())
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		var result object.Object
+		if fn.CallerFn != nil {
+			result = fn.CallerFn(caller{}, args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if exit, ok := result.(*object.Exit); ok {
+			os.Exit(exit.Code)
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -132,6 +194,13 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// caller lets builtins call the functions they are passed.
+type caller struct{}
+
+func (caller) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
 func evalBangOperatorExpression(obj object.Object) object.Object {
 	switch obj {
 	case TRUE:
@@ -153,7 +222,7 @@ func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) obj
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -268,6 +337,93 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalIncrementExpression(node *ast.IncrementExpression, env *object.Environment) object.Object {
+	var current, val object.Object
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current = evalIdentifer(target, env)
+		if isError(current) {
+			return current
+		}
+
+		val = evalInfixExpression(node.Operator, current, &object.Integer{Value: 1})
+		if isError(val) {
+			return val
+		}
+
+		env.Set(target.Value, val)
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+
+		val = evalInfixExpression(node.Operator, current, &object.Integer{Value: 1})
+		if isError(val) {
+			return val
+		}
+
+		if err := object.SetIndex(left, index, val); err != nil {
+			return err
+		}
+	default:
+		return newError("cannot apply %s to %s", node.Token.Literal, node.Target.String())
+	}
+
+	if node.Prefix {
+		return val
+	}
+	return current
+}
+
+func evalIndexAssignment(node *ast.IndexAssignStatement, env *object.Environment) object.Object {
+	left := Eval(node.Target.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	index := Eval(node.Target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != "" {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if node.Operator != "" {
+		val = evalInfixExpression(node.Operator, current, val)
+		if isError(val) {
+			return val
+		}
+	}
+
+	if err := object.SetIndex(left, index, val); err != nil {
+		return err
+	}
+	return val
+}
+
 func evalInfixExpression(operator string,
 	left object.Object,
 	right object.Object) object.Object {
@@ -275,6 +431,8 @@ func evalInfixExpression(operator string,
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumeric(left) && isNumeric(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
@@ -304,7 +462,71 @@ func evalIntegerInfixExpression(operator string,
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &object.Integer{Value: integerPower(leftVal, rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << uint64(rightVal)}
+		}
+		return &object.Integer{Value: leftVal >> uint64(rightVal)}
+
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string,
+	left object.Object,
+	right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -324,12 +546,14 @@ func evalIntegerInfixExpression(operator string,
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
@@ -338,11 +562,70 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return &object.Integer{Value: ^integer.Value}
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
+// modules caches the value of each module once it has been imported, and
+// importing lists the modules being evaluated, outermost first, to detect
+// import cycles.
+var (
+	modules   = map[string]*object.Hash{}
+	importing []string
+)
+
+// evalImport evaluates the module an import names in an environment of its
+// own, the first time it is imported, and returns a hash of its exports.
+func evalImport(node *ast.ImportExpression) object.Object {
+	path, err := parser.FindModule(node.Path, node.Pos().File)
+	if err != nil {
+		return newError("cannot import %q: %s", node.Path, err)
+	}
+
+	if module, ok := modules[path]; ok {
+		return module
+	}
+
+	for i, p := range importing {
+		if p == path {
+			cycle := append(append([]string{}, importing[i:]...), path)
+			return newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, err := parser.ParseFile(path)
+	if err != nil {
+		return newError("cannot import %q:\n%s", node.Path, err)
+	}
+
+	env := object.NewEnvironment()
+	importing = append(importing, path)
+	result := evalProgram(program, env)
+	importing = importing[:len(importing)-1]
+
+	if isError(result) {
+		return result
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, name := range program.Exports() {
+		value, _ := env.Get(name)
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	module := &object.Hash{Pairs: pairs}
+	modules[path] = module
+	return module
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
@@ -354,6 +637,8 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return newError("%s outside loop", result.Inspect())
 		}
 	}
 
@@ -364,14 +649,120 @@ func evalStringInfixExpression(operator string,
 	left object.Object,
 	right object.Object) object.Object {
 
-	if operator != "+" {
-		newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalThrow(val object.Object) object.Object {
+	if err, ok := val.(*object.Error); ok {
+		return err
+	}
+
+	return &object.Error{Message: "uncaught exception: " + val.Inspect(), Value: val}
+}
+
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	if isError(result) {
+		err := result.(*object.Error)
+
+		caught := err.Value
+		if caught == nil {
+			caught = err
+		}
+
+		env.Set(te.Param.Value, caught)
+		result = Eval(te.Handler, env)
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// evalLoopBody evaluates one iteration of a loop, reporting whether the
+// loop should stop and, if so, what it should evaluate to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+
+	switch result {
+	case BREAK:
+		return nil, true
+	case CONTINUE:
+		return nil, false
+	}
+
+	if result != nil {
+		rt := result.Type()
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return result, true
+		}
+	}
+
+	return nil, false
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, stop := evalLoopBody(ws.Body, env); stop {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for {
+		el, ok := iterator.Next()
+		if !ok {
+			return nil
+		}
+
+		env.Set(fs.Name.Value, el)
+
+		if result, stop := evalLoopBody(fs.Body, env); stop {
+			return result
+		}
+	}
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
@@ -389,6 +780,51 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// integerPower raises base to a non-negative exponent by repeated squaring,
+// wrapping on overflow like the other integer operators.
+func integerPower(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func isNumeric(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat widens a numeric object to a float64
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+// evalLogicalExpression finishes evaluating && or || given the value of the
+// left operand, only evaluating the right one if it decides the result.
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -1,6 +1,9 @@
 package evaluator
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gilmae/monkey/lexer"
@@ -302,6 +305,114 @@ func TestEvalBooleanExpression(t *testing.T) {
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
+
+func TestIntegerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"10 % 0", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+	}
+
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q, expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false or false", false},
+		{"1 && \"a\"", true},
+		{"first([]) || false", false},
+		{"let boom = fn() { throw \"evaluated\" }; false && boom()", false},
+		{"let boom = fn() { throw \"evaluated\" }; true or boom()", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval("let boom = fn() { throw \"evaluated\" }; true && boom()")
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("expected the right operand to be evaluated, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1 + 0.5", 1.5},
+		{"10 / 4.0", 2.5},
+		{"1.5 * 2", 3.0},
+		{"1 == 1.0", true},
+		{"1.5 < 1", false},
+		{"round(2.345, 1)", 2.3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			result, ok := evaluated.(*object.Float)
+			if !ok {
+				t.Errorf("obj is not Float, got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if result.Value != expected {
+				t.Errorf("object has wrong value, expected %g, got %g", expected, result.Value)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestEvalIntegerExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -396,6 +507,207 @@ func TestCloseBuiltin(t *testing.T) {
 	}
 }
 
+func TestWriteBuiltins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	input := fmt.Sprintf(`
+	let f = open("%[1]s", "w");
+	write(f, "one ");
+	writeln(f, 2);
+	close(f);
+	let f = open("%[1]s", "a");
+	writeln(f, "three");
+	flush(f);
+	let r = open("%[1]s");
+	lines(r);
+	`, path)
+
+	evaluated := testEval(input)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array, got %T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{"one 2", "three"}
+	if len(arr.Elements) != len(expected) {
+		t.Fatalf("Number of lines wrong, expected %d, got %d, %+v", len(expected), len(arr.Elements), arr.Elements)
+	}
+
+	for i, line := range expected {
+		if arr.Elements[i].Inspect() != line {
+			t.Errorf("line %d wrong, expected %q, got %q", i, line, arr.Elements[i].Inspect())
+		}
+	}
+}
+
+func TestSeekAndReadBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+
+	input := fmt.Sprintf(`
+	let f = open("%s", "w+");
+	write(f, "hello world");
+	seek(f, 6);
+	let a = read_bytes(f, 3);
+	seek(f, -2, 2);
+	let b = read_bytes(f, 10);
+	seek(f, 0);
+	read_bytes(f, 2);
+	seek(f, 1, 1);
+	a + b + read_bytes(f, 2)
+	`, path)
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String, got %T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "worldlo" {
+		t.Errorf("str.Value wrong, expected %q, got %q", "worldlo", str.Value)
+	}
+}
+
+func TestReadBytesHugeCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+
+	input := fmt.Sprintf(`
+	let f = open("%s", "w+");
+	write(f, "hello");
+	seek(f, 0);
+	read_bytes(f, 9223372036854775807)
+	`, path)
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String, got %T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "hello" {
+		t.Errorf("str.Value wrong, expected %q, got %q", "hello", str.Value)
+	}
+}
+
+func TestFilesystemBuiltins(t *testing.T) {
+	dir := t.TempDir()
+
+	input := fmt.Sprintf(`
+	let dir = "%s";
+	let sub = path_join(dir, "a", "b");
+	mkdir(sub);
+	let f = open(path_join(sub, "data.txt"), "w");
+	write(f, "12345");
+	close(f);
+	rename(path_join(sub, "data.txt"), path_join(dir, "a", "moved.txt"));
+	let info = stat(path_join(dir, "a", "moved.txt"));
+	let found = glob(path_join(dir, "a", "*.txt"));
+	let before = exists(sub);
+	remove(sub);
+	[info["size"], info["is_dir"], stat(dir)["is_dir"], list_dir(path_join(dir, "a")), len(found), before, exists(sub)]
+	`, dir)
+
+	evaluated := testEval(input)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array, got %T (%+v)", evaluated, evaluated)
+	}
+
+	expected := "[5, false, true, [moved.txt], 1, true, false]"
+	if arr.Inspect() != expected {
+		t.Errorf("wrong result, expected %s, got %s", expected, arr.Inspect())
+	}
+
+	mtime := testEval(fmt.Sprintf(`stat("%s")["mtime"]`, dir))
+	if i, ok := mtime.(*object.Integer); !ok || i.Value <= 0 {
+		t.Errorf("mtime wrong, got %T (%+v)", mtime, mtime)
+	}
+}
+
+func TestPathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`path_join("a", "b", "c.mk")`, "a/b/c.mk"},
+		{`path_join("a/", "../b")`, "b"},
+		{`basename("/tmp/script.mk")`, "script.mk"},
+		{`dirname("/tmp/script.mk")`, "/tmp"},
+		{`ext("/tmp/script.mk")`, ".mk"},
+		{`ext("Makefile")`, ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String, got %T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("wrong result for %s, expected %q, got %q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fmt.Sprintf(`open("%s")`, missing), fmt.Sprintf("cannot open file: open %s: no such file or directory", missing)},
+		{`open("foobar", "z")`, `cannot open file: unknown file mode "z"`},
+		{`open(1)`, "argument to `open` must be STRING, got INTEGER"},
+		{`write(open("foobar"), "x")`, "file not open for writing: foobar"},
+		{`read_bytes(open("foobar"), -1)`, "count given to `read_bytes` must not be negative, got -1"},
+		{`seek(open("foobar"), 0, 3)`, "whence given to `seek` must be 0, 1 or 2, got 3"},
+		{`let f = open("foobar"); close(f); close(f)`, "file is closed: foobar"},
+		{`lines(1)`, "argument to `lines` must be FILE, got INTEGER"},
+		{fmt.Sprintf(`stat("%s")`, missing), fmt.Sprintf("cannot stat file: stat %s: no such file or directory", missing)},
+		{fmt.Sprintf(`list_dir("%s")`, missing), fmt.Sprintf("cannot list directory: open %s: no such file or directory", missing)},
+		{fmt.Sprintf(`remove("%s")`, missing), fmt.Sprintf("cannot remove: remove %s: no such file or directory", missing)},
+		{`path_join("a", 1)`, "argument 2 to `path_join` must be STRING, got INTEGER"},
+		{`glob("[")`, "invalid glob pattern: syntax error in pattern"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message, expected %q, got %q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestCallbackBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map(["a", "b"], upper)`, "[A, B]"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort([1, 3, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`try { map([1], fn(x) { throw "bad" }) } catch (e) { e }`, "bad"},
+		{`map([1], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s, expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -536,6 +848,109 @@ func TestAssignStatements(t *testing.T) {
 	}
 }
 
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; a += 2; a", "3"},
+		{"let a = 10; a -= 4; a", "6"},
+		{"let a = 3; a *= 2 + 1; a", "9"},
+		{"let a = 7; a /= 2; a", "3"},
+		{"let a = 7; a %= 4; a", "3"},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let total = 0; for (x in [1, 2, 3]) { total += x }; total", "6"},
+		{"let a = [1, 2]; a[1] += 10; a", "[1, 12]"},
+		{`let h = {"xs": [5]}; h["xs"][0] -= 1; h["xs"]`, "[4]"},
+		{"let a = 1; a /= 0", "ERROR: division by zero"},
+		{"b += 1", "ERROR: identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s, expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let i = 1; i++", "1"},
+		{"let i = 1; i++; i", "2"},
+		{"let i = 1; ++i", "2"},
+		{"let i = 1; i--; i", "0"},
+		{"let i = 1; --i", "0"},
+		{"let i = 0; while (i < 5) { i++ }; i", "5"},
+		{"let a = [1, 2]; a[1]++", "2"},
+		{"let a = [1, 2]; a[1]++; a", "[1, 3]"},
+		{"let a = [1, 2]; --a[0]; a", "[0, 2]"},
+		{`let h = {"n": 1}; h["n"]++ + h["n"]++`, "3"},
+		{"b++", "ERROR: identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s, expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2, 3]; a[1] = 5; a", "[1, 5, 3]"},
+		{"let a = [1, 2, 3]; a[0] = a[0] + 10", "11"},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, "2"},
+		{`let h = {"xs": [1, 2]}; h["xs"][1] = 7; h["xs"]`, "[1, 7]"},
+		{"let f = fn(a) { a[0] = 9 }; let a = [0]; f(a); a[0]", "9"},
+		{"let a = [1]; a[1] = 2", "ERROR: index out of range: 1, length 1"},
+		{`let a = [1]; a["x"] = 2`, "ERROR: index into ARRAY must be INTEGER, got STRING"},
+		{"let h = {}; h[fn() { 1 }] = 2", "ERROR: unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "ERROR: index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s, expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1 }; i", 10},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let i = 0; while (true) { i = i + 1; if (i == 5) { break } }; i", 5},
+		{"let sum = 0; for (x in [1, 2, 3, 4, 5, 6]) { if (x == 3) { continue } if (x == 5) { break } sum = sum + x }; sum", 7},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x } } 0 }; f()", 2},
+		{"let n = 0; while (n < 5000) { n = n + 1 }; n", 5000},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("break")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got %T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "break outside loop" {
+		t.Errorf("wrong error message, expected %q, got %q", "break outside loop", errObj.Message)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -599,6 +1014,33 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"a" <= "a"`, true},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"monkey" != "monkey"`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval(`"a" - "b"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got %T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "unknown operator: STRING - STRING" {
+		t.Errorf("wrong error message, got %q", errObj.Message)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"hello world`
 
@@ -613,6 +1055,42 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e + 1 }", 6},
+		{`try { int("x") } catch (e) { 7 }`, 7},
+		{"let f = fn() { throw 4 }; try { f() } catch (e) { e }", 4},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+		{"let a = 1 + try { throw 1 } catch (e) { 10 }; a", 11},
+		{"try { } catch (e) { 1 }", nil},
+		{"throw 4", "uncaught exception: 4"},
+		{"try { 5 + true } catch (e) { throw e }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned, got %T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, expected %q, got %q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestUseStatements(t *testing.T) {
 	input := `use("foobar"); x(1);`
 
@@ -677,3 +1155,43 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 
 	return true
 }
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/helpers.mk": `let shout = fn(s) { upper(s) + "!" }`,
+		"lib/strings.mk": `let helpers = import("helpers"); let greet = fn(name) { helpers["shout"]("hello " + name) }; let _secret = 1;`,
+		"a.mk":           `let b = import("b")`,
+		"b.mk":           `let a = import("a")`,
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evaluated := testEval(fmt.Sprintf(`let s = import(%q); s["greet"]("monkey")`, dir+"/lib/strings"))
+	str, ok := evaluated.(*object.String)
+	if !ok || str.Value != "HELLO MONKEY!" {
+		t.Errorf("wrong import result, got %T (%+v)", evaluated, evaluated)
+	}
+
+	evaluated = testEval(fmt.Sprintf(`import(%q)["_secret"]`, dir+"/lib/strings"))
+	testNullObject(t, evaluated)
+
+	a, b := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk")
+	evaluated = testEval(fmt.Sprintf(`import(%q)`, dir+"/a"))
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got %T (%+v)", evaluated, evaluated)
+	}
+
+	expected := fmt.Sprintf("import cycle: %s -> %s -> %s", a, b, a)
+	if errObj.Message != expected {
+		t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+	}
+}
@@ -9,15 +9,24 @@ type Lexer struct {
 	readPosition int
 	ch           byte
 	line         int
+	lineStart    int
+	filename     string
 }
 
 // New initialises a Lexer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// NewWithFilename initialises a Lexer whose token positions refer to filename
+func NewWithFilename(input string, filename string) *Lexer {
+	l := New(input)
+	l.filename = filename
+	return l
+}
+
 func (l *Lexer) Line() int {
 	return l.line
 }
@@ -27,6 +36,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.currentPosition()
 	switch l.ch {
 	case '#':
 		// Comment, skip
@@ -64,13 +74,53 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' {
+			l.readChar()
+			tok = token.Token{Type: token.INCREMENT, Literal: "++"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUSASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' {
+			l.readChar()
+			tok = token.Token{Type: token.DECREMENT, Literal: "--"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUSASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERIX, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: "**"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERIXASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.ASTERIX, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PERCENTASSIGN, Literal: "%="}
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '/':
-		tok = newToken(token.FSLASH, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.FSLASHASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.FSLASH, l.ch)
+		}
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '!':
@@ -82,12 +132,29 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			lit := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.LTE, Literal: lit}
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.SHL, Literal: "<<"}
 		} else {
 			tok = newToken(token.LT, l.ch)
 		}
@@ -98,6 +165,9 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			lit := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.GTE, Literal: lit}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.SHR, Literal: ">>"}
 		} else {
 			tok = newToken(token.GT, l.ch)
 		}
@@ -108,11 +178,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		}
 		if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		}
 		tok = newToken(token.ILLEGAL, l.ch)
@@ -120,9 +191,18 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		File:   l.filename,
+		Line:   l.line,
+		Column: l.position - l.lineStart + 1,
+	}
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -151,6 +231,7 @@ func (l *Lexer) readChar() {
 	l.position = l.readPosition
 	if l.ch == '\n' {
 		l.line += 1
+		l.lineStart = l.position + 1
 	}
 	l.readPosition++
 }
@@ -163,19 +244,57 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float if the digits are followed by a
+// fraction or an exponent, e.g. 1.5, 2e10 or 6.02E-23
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
+	var tokenType token.TokenType = token.INT
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return tokenType, l.input[position:l.position]
+}
+
+// isExponent reports whether the 'e' at the current position starts an
+// exponent, i.e. is followed by digits with an optional sign.
+func (l *Lexer) isExponent() bool {
+	next := l.readPosition
+	if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+		next++
+	}
+	return next < len(l.input) && isDigit(l.input[next])
 }
 
 func (l *Lexer) readString() string {
 	position := l.position + 1
 	for {
 		l.readChar()
+		if l.ch == '\\' && l.peekChar() != 0 {
+			// Skip the escaped character so that \" doesn't end the string
+			l.readChar()
+			continue
+		}
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
@@ -189,7 +308,7 @@ func (l *Lexer) readString() string {
 	position = 0
 	for {
 		ch := str[position]
-		if ch == '\\' {
+		if ch == '\\' && position+1 < len(str) {
 			switch str[position+1] {
 			case 't':
 				ret = ret + string('\t')
@@ -200,6 +319,9 @@ func (l *Lexer) readString() string {
 			case '\\':
 				ret = ret + string('\\')
 				position += 1
+			case '"':
+				ret = ret + string('"')
+				position += 1
 			default:
 				ret = ret + string('\\')
 			}
@@ -157,3 +157,286 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "a b";
+# comment
+fn`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 2, 12},
+		{token.FUNCTION, 4, 1},
+		{token.EOF, 4, 3},
+	}
+
+	l := NewWithFilename(input, "test.mk")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong, expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.File != "test.mk" {
+			t.Errorf("tests[%d] - file wrong, expected=%q, got=%q", i, "test.mk", tok.Pos.File)
+		}
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	input := `5 5.25 0.5 1e3 2.5E-3 6e+2 7e 8.x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "5.25"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e3"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "6e+2"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.INT, "8"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLogicalOperatorTokens(t *testing.T) {
+	input := `a && b || c and d or e & f | g`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.AND, "and"},
+		{token.IDENT, "d"},
+		{token.OR, "or"},
+		{token.IDENT, "e"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "f"},
+		{token.PIPE, "|"},
+		{token.IDENT, "g"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestArithmeticOperatorTokens(t *testing.T) {
+	input := `a % b ** c * d ^ ~e << f >> g <= h >= i`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.ASTERIX, "*"},
+		{token.IDENT, "d"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "e"},
+		{token.SHL, "<<"},
+		{token.IDENT, "f"},
+		{token.SHR, ">>"},
+		{token.IDENT, "g"},
+		{token.LTE, "<="},
+		{token.IDENT, "h"},
+		{token.GTE, ">="},
+		{token.IDENT, "i"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestCompoundAssignTokens(t *testing.T) {
+	input := `a += 1; b -= c; d *= e ** f; g /= 2; h %= i; j = -1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PLUSASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "b"},
+		{token.MINUSASSIGN, "-="},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "d"},
+		{token.ASTERIXASSIGN, "*="},
+		{token.IDENT, "e"},
+		{token.POWER, "**"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "g"},
+		{token.FSLASHASSIGN, "/="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "h"},
+		{token.PERCENTASSIGN, "%="},
+		{token.IDENT, "i"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "j"},
+		{token.ASSIGN, "="},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIncrementTokens(t *testing.T) {
+	input := `i++; --j; a - -b`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "i"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "j"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\tb"`, "a\tb"},
+		{`"line\n"`, "line\n"},
+		{`"back\\slash"`, `back\slash`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"{\"a\": 1}"`, `{"a": 1}`},
+		{`"trailing\`, `trailing\`},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, token.STRING, tok.Type)
+		}
+
+		if tok.Literal != tt.expected {
+			t.Errorf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expected, tok.Literal)
+		}
+	}
+}
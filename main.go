@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gilmae/monkey/compiler"
 	"github.com/gilmae/monkey/lexer"
+	"github.com/gilmae/monkey/object"
 	"github.com/gilmae/monkey/parser"
 	"github.com/gilmae/monkey/repl"
 	"github.com/gilmae/monkey/vm"
@@ -26,26 +29,119 @@ func main() {
 		os.Exit(1)
 	}
 
-	var err error
-	var input []byte
+	if flag.Arg(0) == "build" {
+		os.Exit(build(flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "disasm" {
+		os.Exit(disasm(flag.Args()[1:]))
+	}
+
 	if *startRepl {
 		fmt.Printf("Monkey v%s\n", version)
 		repl.Start(os.Stdin, os.Stdout)
-	} else if len(flag.Args()) > 0 {
-		input, err = ioutil.ReadFile(os.Args[1])
+		return
+	}
+
+	var err error
+	var input []byte
+	var filename string
+	if len(flag.Args()) > 0 {
+		filename = flag.Arg(0)
+		object.ScriptArgs = flag.Args()[1:]
+		input, err = ioutil.ReadFile(filename)
 	} else {
 		input, err = ioutil.ReadAll(os.Stdin)
 	}
 
+	if err != nil {
+		fmt.Printf("Error reading: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if compiler.IsCompiled(input) {
+		os.Exit(executeCompiled(input))
+	}
+	os.Exit(execute(string(input), filename))
+}
+
+// build compiles a script to a .mkc file that can be run without
+// re-parsing it.
+func build(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "Write the compiled bytecode to this file.")
+	flags.Parse(args)
+
+	// Allow flags both before and after the script name.
+	filename := flags.Arg(0)
+	if filename == "" {
+		fmt.Printf("Usage: monkey build script.mk [-o script.mkc]\n")
+		return 1
+	}
+	flags.Parse(flags.Args()[1:])
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mkc"
+	}
+
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Error reading: %s\n", err.Error())
+		return 1
+	}
+
+	bytecode, ok := compile(string(input), filename)
+	if !ok {
+		return 1
+	}
+
+	data, err := bytecode.MarshalBinary()
 	if err == nil {
-		execute(string(input))
-	} else {
+		err = ioutil.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error writing: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// disasm prints the bytecode a script, or a compiled .mkc file, contains.
+func disasm(args []string) int {
+	if len(args) != 1 {
+		fmt.Printf("Usage: monkey disasm script.mk\n")
+		return 1
+	}
+
+	filename := args[0]
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
 		fmt.Printf("Error reading: %s\n", err.Error())
+		return 1
+	}
+
+	var bytecode *compiler.Bytecode
+	if compiler.IsCompiled(input) {
+		bytecode, err = compiler.Unmarshal(input)
+		if err != nil {
+			fmt.Printf("Error loading bytecode: %s\n", err)
+			return 1
+		}
+	} else {
+		var ok bool
+		bytecode, ok = compile(string(input), filename)
+		if !ok {
+			return 1
+		}
 	}
+
+	compiler.Disassemble(os.Stdout, bytecode)
+	return 0
 }
 
-func execute(input string) int {
-	l := lexer.New(input)
+// compile parses and compiles a script, printing any errors.
+func compile(input string, filename string) (*compiler.Bytecode, bool) {
+	l := lexer.NewWithFilename(input, filename)
 	p := parser.New(l)
 
 	program := p.ParseProgram()
@@ -53,7 +149,7 @@ func execute(input string) int {
 		for _, msg := range p.Errors() {
 			fmt.Printf("\t%s\n", msg)
 		}
-		os.Exit(1)
+		return nil, false
 	}
 
 	// evaluated := evaluator.Eval(program, env)
@@ -66,13 +162,43 @@ func execute(input string) int {
 
 	if err != nil {
 		fmt.Printf("Compile error:\n%s\n", err)
+		return nil, false
+	}
+
+	return comp.Bytecode(), true
+}
+
+func execute(input string, filename string) int {
+	bytecode, ok := compile(input, filename)
+	if !ok {
+		return 1
+	}
+
+	return run(bytecode)
+}
+
+func executeCompiled(input []byte) int {
+	bytecode, err := compiler.Unmarshal(input)
+	if err != nil {
+		fmt.Printf("Error loading bytecode: %s\n", err)
 		return 1
 	}
 
-	machine := vm.New(comp.Bytecode())
-	err = machine.Run()
+	return run(bytecode)
+}
+
+func run(bytecode *compiler.Bytecode) int {
+	machine := vm.New(bytecode)
+	err := machine.Run()
 	if err != nil {
-		fmt.Printf("Executing bytecode failed:\n%s\n", err)
+		if exit, ok := err.(*vm.ExitError); ok {
+			return exit.Code
+		}
+		if rerr, ok := err.(*vm.RuntimeError); ok {
+			fmt.Printf("Executing bytecode failed:\n%s\n", rerr.StackTrace())
+		} else {
+			fmt.Printf("Executing bytecode failed:\n%s\n", err)
+		}
 		return 1
 	}
 
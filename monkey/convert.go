@@ -0,0 +1,116 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gilmae/monkey/object"
+)
+
+// ToObject converts a Go value to a Monkey object. Booleans, numbers,
+// strings, nil, slices, arrays and maps with hashable keys are supported,
+// as are functions with the object.BuiltinFunction signature. Values that
+// are already objects are returned unchanged.
+func ToObject(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return object.NULL, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return object.TRUE, nil
+		}
+		return object.FALSE, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case func(args ...object.Object) object.Object:
+		return &object.Builtin{Fn: value}, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Bool:
+		return ToObject(v.Bool())
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+
+			val, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return ToObject(v.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a monkey object", value)
+}
+
+// FromObject converts a Monkey object to a Go value: int64, float64,
+// string, bool, nil, []interface{} or map[string]interface{}, with hash keys
+// converted to their string form. Other objects, such as functions and
+// files, are returned unchanged.
+func FromObject(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = FromObject(el)
+		}
+		return values
+	case *object.Hash:
+		values := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			values[pair.Key.Inspect()] = FromObject(pair.Value)
+		}
+		return values
+	}
+
+	return obj
+}
@@ -0,0 +1,228 @@
+// Package monkey lets Go programs compile and run Monkey source, share
+// values with it and expose Go functions to it.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gilmae/monkey/ast"
+	"github.com/gilmae/monkey/compiler"
+	"github.com/gilmae/monkey/lexer"
+	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/parser"
+	"github.com/gilmae/monkey/vm"
+)
+
+// Interpreter runs Monkey source. Globals defined by one call to Run are
+// visible to the next, as in the REPL.
+type Interpreter struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	capabilities object.Capability
+	limits       vm.Limits
+	ctx          context.Context
+}
+
+// ParseError is returned when the source given to Run doesn't parse.
+type ParseError struct {
+	Diagnostics []parser.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func New() *Interpreter {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Interpreter{
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalSize),
+
+		capabilities: object.CapAll,
+	}
+}
+
+// Compile compiles source against the interpreter's globals without
+// running it or defining anything new.
+func (i *Interpreter) Compile(source string, filename string) (*compiler.Bytecode, error) {
+	program, err := i.parse(source, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	bytecode, _, err := i.compile(program)
+	return bytecode, err
+}
+
+// Run compiles and runs source, returning the value of its last statement
+// if that is an expression statement, or NULL otherwise. Errors are a *ParseError, a compiler error or a
+// *vm.RuntimeError, or a *vm.ExitError if the script calls `exit`.
+func (i *Interpreter) Run(source string) (object.Object, error) {
+	return i.RunFile(source, "")
+}
+
+// RunFile is Run for source read from filename, which is used in error
+// positions and stack traces.
+func (i *Interpreter) RunFile(source string, filename string) (object.Object, error) {
+	program, err := i.parse(source, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	bytecode, symbolTable, err := i.compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only keep the new definitions once the source has compiled
+	i.symbolTable = symbolTable
+	i.constants = bytecode.Constants
+
+	machine := i.newVM(bytecode)
+	err = machine.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	// The last popped element is only the program's value when its last
+	// statement is an expression; otherwise it's whatever the stack held
+	n := len(program.Statements)
+	if n == 0 {
+		return object.NULL, nil
+	}
+	if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); !ok {
+		return object.NULL, nil
+	}
+
+	result := machine.LastPoppedStackElem()
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
+
+func (i *Interpreter) parse(source string, filename string) (*ast.Program, error) {
+	p := parser.New(lexer.NewWithFilename(source, filename))
+	if i.capabilities&object.CapFilesystem == 0 {
+		p.DisableFileAccess()
+	}
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Diagnostics: p.Errors()}
+	}
+	return program, nil
+}
+
+func (i *Interpreter) compile(program *ast.Program) (*compiler.Bytecode, *compiler.SymbolTable, error) {
+	symbolTable := i.symbolTable.Copy()
+	comp := compiler.NewWithState(symbolTable, i.constants[:len(i.constants):len(i.constants)])
+	comp.SetCapabilities(i.capabilities)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return comp.Bytecode(), symbolTable, nil
+}
+
+// Call calls a Monkey function, such as a closure returned by Run, with
+// arguments converted by ToObject.
+func (i *Interpreter) Call(fn object.Object, args ...interface{}) (object.Object, error) {
+	cl, ok := fn.(*object.Closure)
+	if !ok {
+		return nil, fmt.Errorf("cannot call %s", fn.Type())
+	}
+
+	objects := make([]object.Object, len(args))
+	for n, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", n+1, err)
+		}
+		objects[n] = obj
+	}
+
+	machine := i.newVM(&compiler.Bytecode{Constants: i.constants})
+	return machine.Call(cl, objects...)
+}
+
+// SetCapabilities restricts the builtins later calls to Compile and Run
+// may use. Scripts that use any other builtin fail to compile, as do
+// use() and import without the filesystem capability. All capabilities
+// are granted by default.
+func (i *Interpreter) SetCapabilities(caps object.Capability) {
+	i.capabilities = caps
+}
+
+// SetLimits bounds the resources each later Run or Call may use.
+func (i *Interpreter) SetLimits(limits vm.Limits) {
+	i.limits = limits
+}
+
+// SetContext sets a context whose cancellation stops Run and Call.
+func (i *Interpreter) SetContext(ctx context.Context) {
+	i.ctx = ctx
+}
+
+func (i *Interpreter) newVM(bytecode *compiler.Bytecode) *vm.VM {
+	machine := vm.NewWithGlobalsStore(bytecode, i.globals)
+	machine.SetLimits(i.limits)
+	if i.ctx != nil {
+		machine.SetContext(i.ctx)
+	}
+	return machine
+}
+
+// Register makes fn callable from Monkey as name. It is stored as a global,
+// so it only affects this interpreter and hides any builtin of the same
+// name.
+func (i *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	i.setGlobal(name, &object.Builtin{Fn: fn})
+}
+
+// Set assigns a global variable, converting value with ToObject.
+func (i *Interpreter) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %s", name, err)
+	}
+
+	i.setGlobal(name, obj)
+	return nil
+}
+
+// Get returns the value of a global variable.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	symbol, ok := i.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, false
+	}
+
+	value := i.globals[symbol.Index]
+	if value == nil {
+		return object.NULL, true
+	}
+	return value, true
+}
+
+func (i *Interpreter) setGlobal(name string, value object.Object) {
+	symbol, ok := i.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = i.symbolTable.Define(name)
+	}
+
+	i.globals[symbol.Index] = value
+}
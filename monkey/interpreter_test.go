@@ -0,0 +1,318 @@
+package monkey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/vm"
+)
+
+func TestRunKeepsGlobals(t *testing.T) {
+	interp := New()
+
+	_, err := interp.Run(`let add = fn(a, b) { a + b };`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	result, err := interp.Run(`add(2, 3)`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	if FromObject(result) != int64(5) {
+		t.Errorf("wrong result, want=5, got=%s", result.Inspect())
+	}
+}
+
+func TestRunResultIsLastExpression(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 4;", int64(5)},
+		{"let x = 5;", nil},
+		{"x; let y = 6;", nil},
+		{"", nil},
+		{"x * 2", int64(10)},
+	}
+
+	for _, tt := range tests {
+		result, err := interp.Run(tt.input)
+		if err != nil {
+			t.Fatalf("Run(%q) failed: %s", tt.input, err)
+		}
+
+		if FromObject(result) != tt.expected {
+			t.Errorf("wrong result for %q, want=%v, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	interp := New()
+
+	err := interp.Set("config", map[string]interface{}{
+		"name":  "monkey",
+		"sizes": []int{1, 2, 3},
+		"ratio": 0.5,
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+
+	_, err = interp.Run(`let total = config["sizes"][0] + config["sizes"][2]; let name = config["name"] + "!";`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	total, ok := interp.Get("total")
+	if !ok || FromObject(total) != int64(4) {
+		t.Errorf("wrong total, got=%v (%v)", total, ok)
+	}
+
+	name, ok := interp.Get("name")
+	if !ok || FromObject(name) != "monkey!" {
+		t.Errorf("wrong name, got=%v (%v)", name, ok)
+	}
+
+	err = interp.Set("total", 10)
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+
+	result, err := interp.Run(`total * 2`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if FromObject(result) != int64(20) {
+		t.Errorf("wrong result after Set, want=20, got=%s", result.Inspect())
+	}
+
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("Get returned a value for an undefined global")
+	}
+
+	if _, ok := interp.Get("len"); ok {
+		t.Errorf("Get returned a value for a builtin")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	interp := New()
+
+	var seen []interface{}
+	interp.Register("record", func(args ...object.Object) object.Object {
+		for _, a := range args {
+			seen = append(seen, FromObject(a))
+		}
+		return &object.Integer{Value: int64(len(args))}
+	})
+	interp.Register("len", func(args ...object.Object) object.Object {
+		return &object.String{Value: "shadowed"}
+	})
+
+	result, err := interp.Run(`record(1, "two", [true]) + 1`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	if FromObject(result) != int64(4) {
+		t.Errorf("wrong result, want=4, got=%s", result.Inspect())
+	}
+
+	expected := []interface{}{int64(1), "two", []interface{}{true}}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("wrong arguments seen, want=%v, got=%v", expected, seen)
+	}
+
+	result, err = interp.Run(`len("abc")`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if FromObject(result) != "shadowed" {
+		t.Errorf("registered function did not shadow builtin, got=%s", result.Inspect())
+	}
+
+	other, err := New().Run(`len("abc")`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if FromObject(other) != int64(3) {
+		t.Errorf("registered function leaked into another interpreter, got=%s", other.Inspect())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	interp := New()
+
+	_, err := interp.Run(`let x = ;`)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected *ParseError, got %T (%v)", err, err)
+	}
+
+	_, err = interp.Run(`let y = 1; z`)
+	if err == nil || !strings.Contains(err.Error(), "undefined variable z") {
+		t.Errorf("expected compile error, got %v", err)
+	}
+
+	// A failed compile must not leave y defined without a value
+	_, err = interp.Run(`y`)
+	if err == nil || !strings.Contains(err.Error(), "undefined variable y") {
+		t.Errorf("expected y to be undefined, got %v", err)
+	}
+
+	_, err = interp.RunFile("1 + true", "script.mk")
+	rerr, ok := err.(*vm.RuntimeError)
+	if !ok {
+		t.Fatalf("expected *vm.RuntimeError, got %T (%v)", err, err)
+	}
+	if rerr.Pos.File != "script.mk" {
+		t.Errorf("wrong file in error position, got %q", rerr.Pos.File)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{42, int64(42)},
+		{uint8(7), int64(7)},
+		{float32(1.5), 1.5},
+		{"monkey", "monkey"},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{[2]bool{true, false}, []interface{}{true, false}},
+		{map[int]string{1: "one"}, map[string]interface{}{"1": "one"}},
+		{&[]int{1}, []interface{}{int64(1)}},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Fatalf("ToObject(%v) failed: %s", tt.input, err)
+		}
+
+		got := FromObject(obj)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("round trip of %v wrong, want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	_, err := ToObject(make(chan int))
+	if err == nil || err.Error() != "cannot convert chan int to a monkey object" {
+		t.Errorf("wrong error for unsupported type, got %v", err)
+	}
+
+	_, err = ToObject(map[[2]int]int{{1, 2}: 3})
+	if err == nil || err.Error() != "unusable as hash key: ARRAY" {
+		t.Errorf("wrong error for unhashable key, got %v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	interp := New()
+
+	handler, err := interp.Run(`let count = 0; fn(event) { count = count + 1; event["name"] + "!" }`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := interp.Call(handler, map[string]string{"name": "click"})
+		if err != nil {
+			t.Fatalf("Call failed: %s", err)
+		}
+		if FromObject(result) != "click!" {
+			t.Errorf("wrong result, want=click!, got=%s", result.Inspect())
+		}
+	}
+
+	count, _ := interp.Get("count")
+	if FromObject(count) != int64(2) {
+		t.Errorf("handler did not update globals, count=%s", count.Inspect())
+	}
+
+	_, err = interp.Call(&object.Integer{Value: 1})
+	if err == nil || err.Error() != "cannot call INTEGER" {
+		t.Errorf("wrong error calling a non-function, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	interp := New()
+	interp.SetLimits(vm.Limits{MaxInstructions: 10000})
+
+	_, err := interp.Run(`let spin = fn() { while (true) { } }; 1`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	_, err = interp.Run(`spin()`)
+	var limitErr *vm.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Kind != vm.LimitInstructions {
+		t.Errorf("expected instruction limit error from Run, got %T (%v)", err, err)
+	}
+
+	spin, _ := interp.Get("spin")
+	_, err = interp.Call(spin)
+	if !errors.As(err, &limitErr) || limitErr.Kind != vm.LimitInstructions {
+		t.Errorf("expected instruction limit error from Call, got %T (%v)", err, err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	interp := New()
+	interp.SetCapabilities(object.CapNone)
+
+	_, err := interp.Run(`open("data.txt")`)
+	if err == nil || err.Error() != "1:1: open is not available: it needs the filesystem capability" {
+		t.Errorf("expected capability error, got %v", err)
+	}
+
+	secret := filepath.Join(t.TempDir(), "secret.mk")
+	if err := os.WriteFile(secret, []byte(`let secret = "hunter2";`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = interp.Run(`use("` + secret + `"); secret`)
+	if err == nil || err.Error() != "1:1: use is not available: it needs the filesystem capability" {
+		t.Errorf("expected capability error for use, got %v", err)
+	}
+
+	_, err = interp.Run(`import("` + secret + `")["secret"]`)
+	if err == nil || err.Error() != "1:1: import is not available: it needs the filesystem capability" {
+		t.Errorf("expected capability error for import, got %v", err)
+	}
+
+	result, err := interp.Run(`len("monkey")`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if FromObject(result) != int64(6) {
+		t.Errorf("wrong result, want=6, got=%s", result.Inspect())
+	}
+
+	interp.SetCapabilities(object.CapProcess)
+
+	_, err = interp.Run(`let quit = fn(code) { exit(code) }; quit(9)`)
+	var exitErr *vm.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 9 {
+		t.Fatalf("expected exit status 9 from Run, got %T (%v)", err, err)
+	}
+
+	quit, _ := interp.Get("quit")
+	_, err = interp.Call(quit, &object.Integer{Value: 2})
+	if !errors.As(err, &exitErr) || exitErr.Code != 2 {
+		t.Errorf("expected exit status 2 from Call, got %T (%v)", err, err)
+	}
+}
@@ -2,10 +2,21 @@ package object
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// MaxRepeatLength is the longest string `repeat` will build, in bytes.
+const MaxRepeatLength = 1 << 30
+
+// ScriptArgs holds the command-line arguments following the script name,
+// as returned by the `args` builtin.
+var ScriptArgs []string
+
 var Builtins = []struct {
 	Name    string
 	Builtin *Builtin
@@ -179,14 +190,23 @@ var Builtins = []struct {
 		"open",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if args[0].Type() != STRING_OBJ {
-					return newError("argument to `open` must be STRING, got %s", args[0].Type())
+				want := []ObjectType{STRING_OBJ}
+				if len(args) == 2 {
+					want = append(want, STRING_OBJ)
+				}
+				if err := checkArgs("open", args, want...); err != nil {
+					return err
 				}
 
-				filename := args[0].(*String)
-				f := &File{Filename: filename.Value}
+				f := &File{Filename: args[0].(*String).Value}
+				if len(args) == 2 {
+					f.Mode = args[1].(*String).Value
+				}
 
-				f.Open()
+				err := f.Open()
+				if err != nil {
+					return newError("cannot open file: %s", err)
+				}
 
 				return f
 			},
@@ -196,8 +216,8 @@ var Builtins = []struct {
 		"read",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if args[0].Type() != FILE_OBJ {
-					return newError("argument to `read` must be FILE, got %s", args[0].Type())
+				if err := checkArgs("read", args, FILE_OBJ); err != nil {
+					return err
 				}
 
 				f := args[0].(*File)
@@ -209,8 +229,8 @@ var Builtins = []struct {
 		"lines",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if args[0].Type() != FILE_OBJ {
-					return newError("argument to `push` must be FILE, got %s", args[0].Type())
+				if err := checkArgs("lines", args, FILE_OBJ); err != nil {
+					return err
 				}
 
 				f := args[0].(*File)
@@ -222,8 +242,8 @@ var Builtins = []struct {
 		"close",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if args[0].Type() != FILE_OBJ {
-					return newError("argument to `push` must be FILE, got %s", args[0].Type())
+				if err := checkArgs("close", args, FILE_OBJ); err != nil {
+					return err
 				}
 
 				f := args[0].(*File)
@@ -238,51 +258,779 @@ var Builtins = []struct {
 				if len(args) != 3 {
 					return newError("wrong number of arguments. got=%d, want=%d",
 						len(args),
-						1)
+						3)
 				}
 
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
 				}
 
-				if args[1].Type() != INTEGER_OBJ {
-					return newError("index `set` into ARRAY must be INTEGER, got %s", args[0].Type())
+				if err := SetIndex(args[0], args[1], args[2]); err != nil {
+					return err
 				}
 
-				arr := args[0].(*Array)
-				idx := args[1].(*Integer)
+				return args[0]
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					return &Integer{Value: int64(arg.Value)}
+				case *String:
+					i, err := strconv.ParseInt(arg.Value, 10, 64)
+					if err != nil {
+						return newError("string is not an int, got %s", arg.Value)
+					}
 
-				arr.Elements[idx.Value] = args[2]
+					return &Integer{Value: i}
+				default:
+					return newError("argument to `int` must be STRING, INTEGER or FLOAT, got %s", args[0].Type())
+				}
 
-				return arr
 			},
 		},
 	},
 	{
-		"int",
+		"exit",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+
+				code := int64(0)
+				if len(args) == 1 {
+					if err := checkArgs("exit", args, INTEGER_OBJ); err != nil {
+						return err
+					}
+					code = args[0].(*Integer).Value
+				}
+
+				return &Exit{Code: int(code)}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=%d",
+						len(args),
+						1)
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *Float:
+					return arg
+				case *String:
+					f, err := strconv.ParseFloat(arg.Value, 64)
+					if err != nil {
+						return newError("string is not a float, got %s", arg.Value)
+					}
+
+					return &Float{Value: f}
+				default:
+					return newError("argument to `float` must be STRING, INTEGER or FLOAT, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"round",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+
+				var value float64
+				switch arg := args[0].(type) {
+				case *Integer:
+					value = float64(arg.Value)
+				case *Float:
+					value = arg.Value
+				default:
+					return newError("argument to `round` must be INTEGER or FLOAT, got %s", args[0].Type())
+				}
+
+				places := int64(0)
+				if len(args) == 2 {
+					p, ok := args[1].(*Integer)
+					if !ok {
+						return newError("places given to `round` must be INTEGER, got %s", args[1].Type())
+					}
+					places = p.Value
+				}
+
+				scale := math.Pow(10, float64(places))
+				return &Float{Value: math.Round(value*scale) / scale}
+			},
+		},
+	},
+	{
+		"split",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("split", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return newStringArray(strings.Split(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"join",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("join", args, ARRAY_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				elements := args[0].(*Array).Elements
+				parts := make([]string, len(elements))
+				for i, el := range elements {
+					str, ok := el.(*String)
+					if !ok {
+						return newError("elements given to `join` must be STRING, got %s", el.Type())
+					}
+					parts[i] = str.Value
+				}
+				return &String{Value: strings.Join(parts, args[1].(*String).Value)}
+			},
+			Size: func(args ...Object) (ObjectType, int64) {
+				arr, ok := argAt(args, 0).(*Array)
+				sep, ok2 := argAt(args, 1).(*String)
+				if !ok || !ok2 || len(arr.Elements) == 0 {
+					return STRING_OBJ, 0
+				}
+
+				size := int64(len(sep.Value)) * int64(len(arr.Elements)-1)
+				for _, el := range arr.Elements {
+					if str, ok := el.(*String); ok {
+						size += int64(len(str.Value))
+					}
+				}
+				return STRING_OBJ, size
+			},
+		},
+	},
+	{
+		"trim",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("trim", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"replace",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("replace", args, STRING_OBJ, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				str := args[0].(*String).Value
+				old := args[1].(*String).Value
+				new := args[2].(*String).Value
+				return &String{Value: strings.ReplaceAll(str, old, new)}
+			},
+			Size: func(args ...Object) (ObjectType, int64) {
+				str, ok := argAt(args, 0).(*String)
+				old, ok2 := argAt(args, 1).(*String)
+				new, ok3 := argAt(args, 2).(*String)
+				if !ok || !ok2 || !ok3 {
+					return STRING_OBJ, 0
+				}
+
+				size := int64(len(str.Value))
+				if grow := int64(len(new.Value) - len(old.Value)); grow > 0 {
+					count := int64(strings.Count(str.Value, old.Value))
+					size += mulSize(count, grow)
+				}
+				return STRING_OBJ, size
+			},
+		},
+	},
+	{
+		"contains",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("contains", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return nativeBool(strings.Contains(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"index_of",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("index_of", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &Integer{Value: int64(strings.Index(args[0].(*String).Value, args[1].(*String).Value))}
+			},
+		},
+	},
+	{
+		"upper",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("upper", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"lower",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("lower", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: strings.ToLower(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"starts_with",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("starts_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return nativeBool(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"ends_with",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("ends_with", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return nativeBool(strings.HasSuffix(args[0].(*String).Value, args[1].(*String).Value))
+			},
+		},
+	},
+	{
+		"substr",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				if args[0].Type() != STRING_OBJ {
-					return newError("argument to `push` must be STRING, got %s", args[0].Type())
+				want := []ObjectType{STRING_OBJ, INTEGER_OBJ}
+				if len(args) == 3 {
+					want = append(want, INTEGER_OBJ)
+				}
+				if err := checkArgs("substr", args, want...); err != nil {
+					return err
+				}
+
+				str := args[0].(*String).Value
+				start := args[1].(*Integer).Value
+				if start < 0 || start > int64(len(str)) {
+					return newError("start given to `substr` out of range, got %d", start)
 				}
 
-				s := args[0].(*String)
-				i, err := strconv.ParseInt(s.Value, 10, 64)
+				end := int64(len(str))
+				if len(args) == 3 {
+					length := args[2].(*Integer).Value
+					if length < 0 {
+						return newError("length given to `substr` must not be negative, got %d", length)
+					}
+					if length < end-start {
+						end = start + length
+					}
+				}
+
+				return &String{Value: str[start:end]}
+			},
+		},
+	},
+	{
+		"repeat",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("repeat", args, STRING_OBJ, INTEGER_OBJ); err != nil {
+					return err
+				}
+
+				str := args[0].(*String).Value
+				count := args[1].(*Integer).Value
+				if count < 0 {
+					return newError("count given to `repeat` must not be negative, got %d", count)
+				}
+				if len(str) > 0 && count > MaxRepeatLength/int64(len(str)) {
+					return newError("result of `repeat` too long: more than %d bytes", MaxRepeatLength)
+				}
+				return &String{Value: strings.Repeat(str, int(count))}
+			},
+			Size: func(args ...Object) (ObjectType, int64) {
+				str, ok := argAt(args, 0).(*String)
+				count, ok2 := argAt(args, 1).(*Integer)
+				if !ok || !ok2 || count.Value < 0 {
+					return STRING_OBJ, 0
+				}
+				return STRING_OBJ, mulSize(int64(len(str.Value)), count.Value)
+			},
+		},
+	},
+	{
+		"json_parse",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("json_parse", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				result, err := ParseJSON(args[0].(*String).Value)
 				if err != nil {
-					return newError("string is not an int, got %s", s.Value)
+					return newError("invalid JSON: %s", err)
+				}
+				return result
+			},
+		},
+	},
+	{
+		"json_stringify",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
 				}
 
-				return &Integer{Value: i}
+				indent := ""
+				if len(args) == 2 {
+					switch arg := args[1].(type) {
+					case *Integer:
+						if arg.Value < 0 {
+							return newError("indent given to `json_stringify` must not be negative, got %d", arg.Value)
+						}
+						indent = strings.Repeat(" ", int(arg.Value))
+					case *String:
+						indent = arg.Value
+					default:
+						return newError("indent given to `json_stringify` must be INTEGER or STRING, got %s", args[1].Type())
+					}
+				}
 
+				result, err := StringifyJSON(args[0], indent)
+				if err != nil {
+					return newError("%s", err)
+				}
+				return &String{Value: result}
 			},
 		},
 	},
 	{
-		"exit",
+		"write",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				os.Exit(0)
-				return nil
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if err := checkArgs("write", args[:1], FILE_OBJ); err != nil {
+					return err
+				}
+
+				return args[0].(*File).Write(args[1].Inspect())
+			},
+		},
+	},
+	{
+		"writeln",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if err := checkArgs("writeln", args[:1], FILE_OBJ); err != nil {
+					return err
+				}
+
+				return args[0].(*File).Write(args[1].Inspect() + "\n")
+			},
+		},
+	},
+	{
+		"flush",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("flush", args, FILE_OBJ); err != nil {
+					return err
+				}
+
+				return args[0].(*File).Flush()
+			},
+		},
+	},
+	{
+		"seek",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				want := []ObjectType{FILE_OBJ, INTEGER_OBJ}
+				if len(args) == 3 {
+					want = append(want, INTEGER_OBJ)
+				}
+				if err := checkArgs("seek", args, want...); err != nil {
+					return err
+				}
+
+				whence := int64(0)
+				if len(args) == 3 {
+					whence = args[2].(*Integer).Value
+				}
+
+				return args[0].(*File).SeekTo(args[1].(*Integer).Value, int(whence))
+			},
+		},
+	},
+	{
+		"read_bytes",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("read_bytes", args, FILE_OBJ, INTEGER_OBJ); err != nil {
+					return err
+				}
+
+				n := args[1].(*Integer).Value
+				if n < 0 {
+					return newError("count given to `read_bytes` must not be negative, got %d", n)
+				}
+
+				return args[0].(*File).ReadBytes(n)
+			},
+			Size: func(args ...Object) (ObjectType, int64) {
+				_, ok := argAt(args, 0).(*File)
+				n, ok2 := argAt(args, 1).(*Integer)
+				if !ok || !ok2 || n.Value < 0 {
+					return STRING_OBJ, 0
+				}
+				return STRING_OBJ, n.Value
+			},
+		},
+	},
+	{
+		"exists",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("exists", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				_, err := os.Stat(args[0].(*String).Value)
+				return nativeBool(err == nil)
+			},
+		},
+	},
+	{
+		"stat",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("stat", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				info, err := os.Stat(args[0].(*String).Value)
+				if err != nil {
+					return newError("cannot stat file: %s", err)
+				}
+
+				return newHash(map[string]Object{
+					"size":   &Integer{Value: info.Size()},
+					"mtime":  &Integer{Value: info.ModTime().Unix()},
+					"is_dir": nativeBool(info.IsDir()),
+				})
+			},
+		},
+	},
+	{
+		"list_dir",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("list_dir", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				entries, err := os.ReadDir(args[0].(*String).Value)
+				if err != nil {
+					return newError("cannot list directory: %s", err)
+				}
+
+				names := make([]string, len(entries))
+				for i, entry := range entries {
+					names[i] = entry.Name()
+				}
+				return newStringArray(names)
+			},
+		},
+	},
+	{
+		"mkdir",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("mkdir", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				err := os.MkdirAll(args[0].(*String).Value, 0755)
+				if err != nil {
+					return newError("cannot make directory: %s", err)
+				}
+				return TRUE
+			},
+		},
+	},
+	{
+		"remove",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("remove", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				err := os.Remove(args[0].(*String).Value)
+				if err != nil {
+					return newError("cannot remove: %s", err)
+				}
+				return TRUE
+			},
+		},
+	},
+	{
+		"rename",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("rename", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				err := os.Rename(args[0].(*String).Value, args[1].(*String).Value)
+				if err != nil {
+					return newError("cannot rename: %s", err)
+				}
+				return TRUE
+			},
+		},
+	},
+	{
+		"glob",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("glob", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				matches, err := filepath.Glob(args[0].(*String).Value)
+				if err != nil {
+					return newError("invalid glob pattern: %s", err)
+				}
+				return newStringArray(matches)
+			},
+		},
+	},
+	{
+		"path_join",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				parts := make([]string, len(args))
+				for i, arg := range args {
+					str, ok := arg.(*String)
+					if !ok {
+						return newError("argument %d to `path_join` must be STRING, got %s", i+1, arg.Type())
+					}
+					parts[i] = str.Value
+				}
+
+				return &String{Value: filepath.Join(parts...)}
+			},
+		},
+	},
+	{
+		"basename",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("basename", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: filepath.Base(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"dirname",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("dirname", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: filepath.Dir(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"ext",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("ext", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				return &String{Value: filepath.Ext(args[0].(*String).Value)}
+			},
+		},
+	},
+	{
+		"args",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("args", args); err != nil {
+					return err
+				}
+
+				return newStringArray(ScriptArgs)
+			},
+		},
+	},
+	{
+		"getenv",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("getenv", args, STRING_OBJ); err != nil {
+					return err
+				}
+
+				value, ok := os.LookupEnv(args[0].(*String).Value)
+				if !ok {
+					return NULL
+				}
+				return &String{Value: value}
+			},
+		},
+	},
+	{
+		"setenv",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("setenv", args, STRING_OBJ, STRING_OBJ); err != nil {
+					return err
+				}
+
+				err := os.Setenv(args[0].(*String).Value, args[1].(*String).Value)
+				if err != nil {
+					return newError("cannot set environment variable: %s", err)
+				}
+				return TRUE
+			},
+		},
+	},
+	{
+		"environ",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if err := checkArgs("environ", args); err != nil {
+					return err
+				}
+
+				values := map[string]Object{}
+				for _, kv := range os.Environ() {
+					if i := strings.IndexByte(kv, '='); i > 0 {
+						values[kv[:i]] = &String{Value: kv[i+1:]}
+					}
+				}
+				return newHash(values)
+			},
+		},
+	},
+	{
+		"map",
+		&Builtin{
+			CallerFn: func(caller Caller, args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if err := checkArgs("map", args[:1], ARRAY_OBJ); err != nil {
+					return err
+				}
+
+				elements := args[0].(*Array).Elements
+				result := make([]Object, len(elements))
+				for i, el := range elements {
+					value := caller.Call(args[1], el)
+					if err, ok := value.(*Error); ok {
+						return err
+					}
+					result[i] = value
+				}
+				return &Array{Elements: result}
+			},
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			CallerFn: func(caller Caller, args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				if err := checkArgs("sort", args[:1], ARRAY_OBJ); err != nil {
+					return err
+				}
+
+				elements := append([]Object{}, args[0].(*Array).Elements...)
+
+				var failed *Error
+				less := func(a, b Object) bool {
+					result, err := compareObjects(a, b)
+					if err != nil {
+						failed = err
+					}
+					return result
+				}
+				if len(args) == 2 {
+					less = func(a, b Object) bool {
+						result := caller.Call(args[1], a, b)
+						if err, ok := result.(*Error); ok {
+							failed = err
+						}
+						return result != NULL && result != FALSE
+					}
+				}
+
+				sort.SliceStable(elements, func(i, j int) bool {
+					return failed == nil && less(elements[i], elements[j])
+				})
+				if failed != nil {
+					return failed
+				}
+
+				return &Array{Elements: elements}
 			},
 		},
 	},
@@ -300,3 +1048,91 @@ func GetBuiltinByName(name string) *Builtin {
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
+
+// checkArgs validates the number and types of the arguments passed to the
+// builtin called name.
+func checkArgs(name string, args []Object, want ...ObjectType) *Error {
+	if len(args) != len(want) {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), len(want))
+	}
+
+	for i, t := range want {
+		if args[i].Type() == t {
+			continue
+		}
+
+		if len(want) == 1 {
+			return newError("argument to `%s` must be %s, got %s", name, t, args[i].Type())
+		}
+		return newError("argument %d to `%s` must be %s, got %s", i+1, name, t, args[i].Type())
+	}
+
+	return nil
+}
+
+func nativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
+func newStringArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, v := range values {
+		elements[i] = &String{Value: v}
+	}
+	return &Array{Elements: elements}
+}
+
+func newHash(values map[string]Object) *Hash {
+	pairs := make(map[HashKey]HashPair, len(values))
+	for k, v := range values {
+		key := &String{Value: k}
+		pairs[key.HashKey()] = HashPair{Key: key, Value: v}
+	}
+	return &Hash{Pairs: pairs}
+}
+
+// compareObjects reports whether a sorts before b when both are numbers or
+// both are strings.
+func compareObjects(a, b Object) (bool, *Error) {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value < b.Value, nil
+		case *Float:
+			return float64(a.Value) < b.Value, nil
+		}
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value < float64(b.Value), nil
+		case *Float:
+			return a.Value < b.Value, nil
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return a.Value < b.Value, nil
+		}
+	}
+
+	return false, newError("cannot compare %s and %s", a.Type(), b.Type())
+}
+
+// argAt returns the i'th argument, or nil if there are too few.
+func argAt(args []Object, i int) Object {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// mulSize multiplies two sizes, saturating instead of overflowing.
+func mulSize(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
@@ -0,0 +1,75 @@
+package object
+
+import "strings"
+
+// Capability is a group of builtins that reach outside the program, which
+// an embedder can choose to withhold from the scripts it runs.
+type Capability uint
+
+const (
+	CapFilesystem Capability = 1 << iota
+	CapProcess
+	CapEnvironment
+	CapNetwork
+
+	CapNone Capability = 0
+	CapAll             = CapFilesystem | CapProcess | CapEnvironment | CapNetwork
+)
+
+var capabilityNames = []struct {
+	cap  Capability
+	name string
+}{
+	{CapFilesystem, "filesystem"},
+	{CapProcess, "process"},
+	{CapEnvironment, "environment"},
+	{CapNetwork, "network"},
+}
+
+func (c Capability) String() string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c&n.cap != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// builtinCapabilities lists the capability each builtin needs. Builtins
+// not listed only work on the values they are given and are always
+// available.
+var builtinCapabilities = map[string]Capability{
+	"open":       CapFilesystem,
+	"read":       CapFilesystem,
+	"lines":      CapFilesystem,
+	"close":      CapFilesystem,
+	"write":      CapFilesystem,
+	"writeln":    CapFilesystem,
+	"flush":      CapFilesystem,
+	"seek":       CapFilesystem,
+	"read_bytes": CapFilesystem,
+	"exists":     CapFilesystem,
+	"stat":       CapFilesystem,
+	"list_dir":   CapFilesystem,
+	"mkdir":      CapFilesystem,
+	"remove":     CapFilesystem,
+	"rename":     CapFilesystem,
+	"glob":       CapFilesystem,
+
+	"exit": CapProcess,
+	"args": CapProcess,
+
+	"getenv":  CapEnvironment,
+	"setenv":  CapEnvironment,
+	"environ": CapEnvironment,
+}
+
+// BuiltinCapability returns the capability the named builtin needs, or
+// CapNone.
+func BuiltinCapability(name string) Capability {
+	return builtinCapabilities[name]
+}
@@ -3,11 +3,26 @@ package object
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
+// fileModes maps the modes accepted by `open` to the flags they open the
+// file with. As with C's fopen, "w" and "a" create the file if it doesn't
+// exist and "w" truncates it.
+var fileModes = map[string]int{
+	"r":  os.O_RDONLY,
+	"r+": os.O_RDWR,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
 type File struct {
 	Filename string
+	Mode     string
 	Handle   *os.File
 	Reader   *bufio.Reader
 	Writer   *bufio.Writer
@@ -18,13 +33,29 @@ func (o *File) Inspect() string {
 	return fmt.Sprintf("<file:%s>", o.Filename)
 }
 
+// Open opens the file in f.Mode, which defaults to "r".
 func (f *File) Open() error {
-	file, err := os.OpenFile(f.Filename, os.O_RDONLY, 0644)
+	if f.Mode == "" {
+		f.Mode = "r"
+	}
+
+	flags, ok := fileModes[f.Mode]
+	if !ok {
+		return fmt.Errorf("unknown file mode %q", f.Mode)
+	}
+
+	file, err := os.OpenFile(f.Filename, flags, 0644)
 	if err != nil {
 		return err
 	}
 	f.Handle = file
-	f.Reader = bufio.NewReader(file)
+
+	if flags&os.O_WRONLY == 0 {
+		f.Reader = bufio.NewReader(file)
+	}
+	if flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.Writer = bufio.NewWriter(file)
+	}
 	return nil
 }
 
@@ -34,13 +65,30 @@ func (f *File) Read() Object {
 	}
 
 	s, err := f.Reader.ReadString('\n')
-	if err != nil {
-		return &String{Value: ""}
+	if err != nil && err != io.EOF {
+		return newError("cannot read %s: %s", f.Filename, err)
 	}
 
 	return &String{Value: s}
 }
 
+// ReadBytes reads up to n bytes, returning fewer only at the end of the
+// file. The bytes are read in chunks, so a count far larger than the file
+// allocates no more than the file holds.
+func (f *File) ReadBytes(n int64) Object {
+	if f.Reader == nil {
+		return newError("file not open for reading: %s", f.Filename)
+	}
+
+	var buf strings.Builder
+	_, err := io.CopyN(&buf, f.Reader, n)
+	if err != nil && err != io.EOF {
+		return newError("cannot read %s: %s", f.Filename, err)
+	}
+
+	return &String{Value: buf.String()}
+}
+
 func (f *File) ReadAll() Object {
 	if f.Reader == nil {
 		return &String{Value: ""}
@@ -48,7 +96,7 @@ func (f *File) ReadAll() Object {
 
 	var lines []string
 
-	scanner := bufio.NewScanner(f.Handle)
+	scanner := bufio.NewScanner(f.Reader)
 	scanner.Split(bufio.ScanLines)
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
@@ -64,8 +112,91 @@ func (f *File) ReadAll() Object {
 
 }
 
+// Write writes s to the file's buffer, returning the number of bytes
+// written.
+func (f *File) Write(s string) Object {
+	if f.Writer == nil {
+		return newError("file not open for writing: %s", f.Filename)
+	}
+
+	n, err := f.Writer.WriteString(s)
+	if err != nil {
+		return newError("cannot write %s: %s", f.Filename, err)
+	}
+
+	return &Integer{Value: int64(n)}
+}
+
+func (f *File) Flush() Object {
+	if f.Writer == nil {
+		return newError("file not open for writing: %s", f.Filename)
+	}
+
+	err := f.Writer.Flush()
+	if err != nil {
+		return newError("cannot write %s: %s", f.Filename, err)
+	}
+
+	return TRUE
+}
+
+// SeekTo moves to offset relative to whence (0 for the start of the file, 1
+// for the current position and 2 for the end) and returns the new offset.
+// Pending writes are flushed and buffered reads discarded first.
+func (f *File) SeekTo(offset int64, whence int) Object {
+	if f.Handle == nil {
+		return newError("file is closed: %s", f.Filename)
+	}
+
+	if whence < io.SeekStart || whence > io.SeekEnd {
+		return newError("whence given to `seek` must be 0, 1 or 2, got %d", whence)
+	}
+
+	if f.Writer != nil {
+		err := f.Writer.Flush()
+		if err != nil {
+			return newError("cannot write %s: %s", f.Filename, err)
+		}
+	}
+
+	if f.Reader != nil && whence == io.SeekCurrent {
+		// The handle is ahead of the reader by whatever is still buffered
+		offset -= int64(f.Reader.Buffered())
+	}
+
+	pos, err := f.Handle.Seek(offset, whence)
+	if err != nil {
+		return newError("cannot seek %s: %s", f.Filename, err)
+	}
+
+	if f.Reader != nil {
+		f.Reader.Reset(f.Handle)
+	}
+
+	return &Integer{Value: pos}
+}
+
 func (f *File) Close() Object {
-	f.Handle.Close()
+	if f.Handle == nil {
+		return newError("file is closed: %s", f.Filename)
+	}
+
+	var err error
+	if f.Writer != nil {
+		err = f.Writer.Flush()
+	}
+
+	closeErr := f.Handle.Close()
+	if err == nil {
+		err = closeErr
+	}
+
 	f.Handle = nil
-	return &Boolean{Value: true}
+	f.Reader = nil
+	f.Writer = nil
+
+	if err != nil {
+		return newError("cannot close %s: %s", f.Filename, err)
+	}
+	return TRUE
 }
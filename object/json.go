@@ -0,0 +1,132 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseJSON decodes a JSON document into Monkey objects. Numbers without a
+// fraction or exponent become Integers, all others Floats.
+func ParseJSON(input string) (Object, error) {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return fromJSON(value), nil
+}
+
+func fromJSON(value interface{}) Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		if value {
+			return TRUE
+		}
+		return FALSE
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return &Integer{Value: i}
+		}
+		f, _ := value.Float64()
+		return &Float{Value: f}
+	case string:
+		return &String{Value: value}
+	case []interface{}:
+		elements := make([]Object, len(value))
+		for i, el := range value {
+			elements[i] = fromJSON(el)
+		}
+		return &Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[HashKey]HashPair, len(value))
+		for k, v := range value {
+			key := &String{Value: k}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: fromJSON(v)}
+		}
+		return &Hash{Pairs: pairs}
+	}
+
+	return NULL
+}
+
+// StringifyJSON encodes obj as JSON, indenting nested values by indent if
+// it isn't empty. Hash keys are written in sorted order.
+func StringifyJSON(obj Object, indent string) (string, error) {
+	value, err := toJSON(obj, map[Object]bool{})
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+
+	err = encoder.Encode(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// toJSON converts obj to the value encoding/json writes for it. The arrays
+// and hashes in converting are those it is nested in, which JSON can't
+// represent it containing.
+func toJSON(obj Object, converting map[Object]bool) (interface{}, error) {
+	switch obj.(type) {
+	case *Array, *Hash:
+		if converting[obj] {
+			return nil, fmt.Errorf("cannot convert cyclic structure to JSON")
+		}
+		converting[obj] = true
+		defer delete(converting, obj)
+	}
+
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			v, err := toJSON(el, converting)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case *Hash:
+		values := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			v, err := toJSON(pair.Value, converting)
+			if err != nil {
+				return nil, err
+			}
+			values[pair.Key.Inspect()] = v
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to JSON", obj.Type())
+	}
+}
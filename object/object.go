@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gilmae/monkey/ast"
@@ -15,6 +18,7 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -27,6 +31,11 @@ const (
 	FILE_OBJ              = "FILE"
 	COMPILED_FUNCTION_ONJ = "COMPILED_FUNCTION"
 	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	ITERATOR_OBJ          = "ITERATOR"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
+	EXIT_OBJ              = "EXIT"
 )
 
 type Object interface {
@@ -55,10 +64,31 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
 
+// TRUE, FALSE and NULL are the only Boolean and Null values; the VM and
+// evaluator compare them by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
@@ -71,6 +101,9 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Value is the value passed to throw, or nil for errors raised by the
+	// interpreter itself
+	Value Object
 	//TODO we're going to want stack traces
 }
 
@@ -105,6 +138,8 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Name          string
+	SourceMap     code.SourceMap
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_ONJ }
@@ -117,8 +152,23 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// Caller is implemented by the VM and the evaluator so that builtins can
+// call the functions they are passed.
+type Caller interface {
+	// Call calls fn with args. If the call fails it returns an *Error.
+	Call(fn Object, args ...Object) Object
+}
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// CallerFn is used instead of Fn by builtins that need to call back
+	// into the running program.
+	CallerFn func(caller Caller, args ...Object) Object
+	// Size, if set, returns the type and size of the value Fn would build
+	// from args, without building it, so a VM can enforce its limits
+	// before allocating. Sizes are in bytes for a STRING and elements for
+	// an ARRAY or HASH. It returns a size of 0 for arguments Fn rejects.
+	Size func(args ...Object) (ObjectType, int64)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -129,12 +179,20 @@ type Array struct {
 }
 
 func (o *Array) Type() ObjectType { return ARRAY_OBJ }
-func (o *Array) Inspect() string {
+func (o *Array) Inspect() string  { return o.inspect(map[Object]bool{}) }
+
+func (o *Array) inspect(inspecting map[Object]bool) string {
+	if inspecting[o] {
+		return "[...]"
+	}
+	inspecting[o] = true
+	defer delete(inspecting, o)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, p := range o.Elements {
-		elements = append(elements, p.Inspect())
+		elements = append(elements, inspect(p, inspecting))
 	}
 
 	out.WriteString("[")
@@ -147,20 +205,54 @@ type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
+// SetIndex stores value at index in an array, which must already have an
+// element there, or in a hash. It returns an error if collection is
+// neither or index is the wrong type.
+func SetIndex(collection, index, value Object) *Error {
+	switch collection := collection.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			return newError("index into ARRAY must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(collection.Elements)) {
+			return newError("index out of range: %d, length %d", i.Value, len(collection.Elements))
+		}
+		collection.Elements[i.Value] = value
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		collection.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported: %s", collection.Type())
+	}
+	return nil
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
 func (o *Hash) Type() ObjectType { return HASH_OBJ }
-func (o *Hash) Inspect() string {
+func (o *Hash) Inspect() string  { return o.inspect(map[Object]bool{}) }
+
+func (o *Hash) inspect(inspecting map[Object]bool) string {
+	if inspecting[o] {
+		return "{...}"
+	}
+	inspecting[o] = true
+	defer delete(inspecting, o)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 	for _, p := range o.Pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			p.Key.Inspect(),
-			p.Value.Inspect()))
+			inspect(p.Value, inspecting)))
 
 	}
 
@@ -170,6 +262,21 @@ func (o *Hash) Inspect() string {
 	return out.String()
 }
 
+// inspect returns the Inspect of an element of an array or hash. The
+// arrays and hashes in inspecting are those it is nested in, and one that
+// contains itself is printed as [...] or {...} rather than recursing
+// forever.
+func inspect(obj Object, inspecting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(inspecting)
+	case *Hash:
+		return obj.inspect(inspecting)
+	default:
+		return obj.Inspect()
+	}
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 
@@ -186,6 +293,10 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -194,10 +305,88 @@ func (s *String) HashKey() HashKey {
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Cell
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Cell holds a variable captured by a closure, so that the closure and the
+// scope it was captured from share a single mutable binding.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return c.Value.Inspect() }
+
+// Iterator steps through the elements of an Array, the characters of a
+// String or the keys of a Hash, in the order a for loop visits them.
+type Iterator struct {
+	elements []Object
+	index    int
+}
+
+// NewIterator returns an Iterator over obj, or false if obj cannot be
+// iterated over. Hash keys are visited in the order of their Inspect
+// strings so that iteration is deterministic.
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		elements := make([]Object, len(obj.Elements))
+		copy(elements, obj.Elements)
+		return &Iterator{elements: elements}, true
+	case *String:
+		elements := []Object{}
+		for _, r := range obj.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+		return &Iterator{elements: elements}, true
+	case *Hash:
+		elements := []Object{}
+		for _, pair := range obj.Pairs {
+			elements = append(elements, pair.Key)
+		}
+		sort.Slice(elements, func(i, j int) bool {
+			return elements[i].Inspect() < elements[j].Inspect()
+		})
+		return &Iterator{elements: elements}, true
+	default:
+		return nil, false
+	}
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return fmt.Sprintf("Iterator[%p]", it) }
+
+// Next returns the next element, or false once the iterator is exhausted
+func (it *Iterator) Next() (Object, bool) {
+	if it.index >= len(it.elements) {
+		return nil, false
+	}
+	el := it.elements[it.index]
+	it.index++
+	return el, true
+}
+
+// Exit is returned by the `exit` builtin to ask whatever is running the
+// program to stop with the given status.
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Type() ObjectType { return EXIT_OBJ }
+func (e *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", e.Code) }
+
+// Break and Continue signal loop control in the evaluator
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
@@ -20,3 +20,49 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different context have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g, expected %q, got %q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestCyclicInspect(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	arr.Elements = append(arr.Elements, arr)
+
+	key := &String{Value: "self"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: hash}
+
+	shared := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{arr, "[1, [...]]"},
+		{hash, "{self: {...}}"},
+		{&Array{Elements: []Object{hash}}, "[{self: {...}}]"},
+		{&Array{Elements: []Object{shared, shared}}, "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect, expected %q, got %q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gilmae/monkey/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic describes a problem found while parsing. Expected lists the
+// tokens that would have been accepted at Pos, when there is a fixed set.
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position
+	Message  string
+	Expected []token.TokenType
+}
+
+// String formats the diagnostic as "position: message", the form the
+// parser has always reported errors in.
+func (d Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+	}
+	return d.Message
+}
+
+// formatDiagnostics joins the diagnostics into one message, one per line.
+func formatDiagnostics(diagnostics []Diagnostic) string {
+	lines := make([]string, len(diagnostics))
+	for i, d := range diagnostics {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
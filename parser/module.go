@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gilmae/monkey/ast"
+	"github.com/gilmae/monkey/lexer"
+)
+
+// ModulePathEnv names the environment variable listing the directories to
+// search for modules that aren't found beside the file importing them.
+const ModulePathEnv = "MONKEY_PATH"
+
+// ModuleExt is added to module names that don't have an extension.
+const ModuleExt = ".mk"
+
+// FindModule returns the absolute path of the file that `import(name)`
+// refers to in the file importer, so that each module has one path however
+// it is named. Relative names are looked for first in the importer's
+// directory, or the working directory if importer is empty, and then in
+// each directory listed in MONKEY_PATH.
+func FindModule(name string, importer string) (string, error) {
+	if filepath.Ext(name) == "" {
+		name += ModuleExt
+	}
+
+	if filepath.IsAbs(name) {
+		if err := checkModule(name); err != nil {
+			return "", err
+		}
+		return filepath.Clean(name), nil
+	}
+
+	dirs := []string{filepath.Dir(importer)}
+	for _, dir := range filepath.SplitList(os.Getenv(ModulePathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		err := checkModule(path)
+		if err == nil {
+			return filepath.Abs(path)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("module not found: %s (searched %s)", name, strings.Join(dirs, ", "))
+}
+
+func checkModule(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// ParseFile reads and parses the source file at path.
+func ParseFile(path string) (*ast.Program, error) {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := New(lexer.NewWithFilename(string(input), path))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(formatDiagnostics(p.Errors()))
+	}
+
+	return program, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strconv"
+	"strings"
 
 	"github.com/gilmae/monkey/ast"
 	"github.com/gilmae/monkey/lexer"
@@ -13,39 +14,70 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	ASSIGN      // =
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // < or >
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
-	PREFIX      // -x or !x
+	PREFIX      // -x, !x or ~x
+	POWER       // **
 	CALL        // myFunction(x)
 	INDEX
+	POSTFIX // x++ or x--
 )
 
 var precedences = map[token.TokenType]int{
-	token.ASSIGN:   ASSIGN,
-	token.EQ:       EQUALS,
-	token.NOTEQ:    EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.GTE:      LESSGREATER,
-	token.LTE:      LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.FSLASH:   PRODUCT,
-	token.ASTERIX:  PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:        ASSIGN,
+	token.PLUSASSIGN:    ASSIGN,
+	token.MINUSASSIGN:   ASSIGN,
+	token.ASTERIXASSIGN: ASSIGN,
+	token.FSLASHASSIGN:  ASSIGN,
+	token.PERCENTASSIGN: ASSIGN,
+	token.OR:            OR,
+	token.AND:           AND,
+	token.EQ:            EQUALS,
+	token.NOTEQ:         EQUALS,
+	token.LT:            LESSGREATER,
+	token.GT:            LESSGREATER,
+	token.GTE:           LESSGREATER,
+	token.LTE:           LESSGREATER,
+	token.PIPE:          BITOR,
+	token.CARET:         BITXOR,
+	token.AMPERSAND:     BITAND,
+	token.SHL:           SHIFT,
+	token.SHR:           SHIFT,
+	token.PLUS:          SUM,
+	token.MINUS:         SUM,
+	token.FSLASH:        PRODUCT,
+	token.ASTERIX:       PRODUCT,
+	token.PERCENT:       PRODUCT,
+	token.POWER:         POWER,
+	token.LPAREN:        CALL,
+	token.LBRACKET:      INDEX,
+	token.INCREMENT:     POSTFIX,
+	token.DECREMENT:     POSTFIX,
 }
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Diagnostic
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// depth is the number of braces opened before curToken and not yet
+	// closed
+	depth int
+
+	// noFileAccess stops use() from reading the file it names
+	noFileAccess bool
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -56,7 +88,7 @@ type (
 )
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []Diagnostic{}}
 
 	// Read two tokens, so that the first two tokens are available as curToken and peekToken
 	p.nextToken()
@@ -65,8 +97,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
+	p.registerPrefix(token.INCREMENT, p.parsePrefixIncrement)
+	p.registerPrefix(token.DECREMENT, p.parsePrefixIncrement)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -76,43 +112,141 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.USE, p.parseUseLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASTERIX, p.parseInfixExpression)
 	p.registerInfix(token.FSLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
 	p.registerInfix(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LTE, p.parseInfixExpression)
 	p.registerInfix(token.GTE, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseLogicalExpression)
+	p.registerInfix(token.OR, p.parseLogicalExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUSASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUSASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERIXASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.FSLASHASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENTASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.INCREMENT, p.parsePostfixIncrement)
+	p.registerInfix(token.DECREMENT, p.parsePostfixIncrement)
 
 	return p
 }
 
-func (p *Parser) Errors() []string {
+// DisableFileAccess stops use() from reading the file it names, for
+// callers that withhold filesystem access from scripts. Such a use is
+// parsed without a body, and the compiler rejects it.
+func (p *Parser) DisableFileAccess() {
+	p.noFileAccess = true
+}
+
+// Errors returns the problems found by ParseProgram, in the order they
+// were found.
+func (p *Parser) Errors() []Diagnostic {
 	return p.errors
 }
 
+// ParseProgram parses the whole input. A statement with an error is left
+// out of the program, and parsing carries on with the next one, so the
+// program never contains nil nodes.
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
+		stmt, ok := p.parseStatementOrRecover()
+		if ok {
 			program.Statements = append(program.Statements, stmt)
+			p.nextToken()
 		}
-		p.nextToken()
 	}
 	return program
 }
 
+// bailout is raised with panic to abandon the statement being parsed after
+// an error.
+type bailout struct{}
+
+// errorf records an error at pos and abandons the current statement.
+func (p *Parser) errorf(pos token.Position, expected []token.TokenType, format string, a ...interface{}) {
+	p.errors = append(p.errors, Diagnostic{
+		Severity: SeverityError,
+		Pos:      pos,
+		Message:  fmt.Sprintf(format, a...),
+		Expected: expected,
+	})
+	panic(bailout{})
+}
+
+// parseStatementOrRecover parses a statement and moves past its last token.
+// If the statement has an error it reports false, leaving the parser at
+// the start of the next statement.
+func (p *Parser) parseStatementOrRecover() (stmt ast.Statement, ok bool) {
+	start, depth := p.curToken, p.depth
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.synchronize(start, depth)
+			stmt, ok = nil, false
+		}
+	}()
+
+	return p.parseStatement(), true
+}
+
+// synchronize skips the rest of a statement with an error, which began
+// with start when depth braces were open. It stops after the semicolon
+// ending the statement, or at a keyword that starts another statement or
+// the brace closing the block the statement is in. Anything between braces
+// opened within the statement is skipped.
+func (p *Parser) synchronize(start token.Token, depth int) {
+	for !p.curTokenIs(token.EOF) {
+		if p.depth == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				p.nextToken()
+				return
+			}
+
+			_, starts := statementStarts[p.curToken.Type]
+			if (starts || p.curTokenIs(token.RBRACE)) && p.curToken.Pos != start.Pos {
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+// statementStarts are the keywords that can only begin a statement.
+var statementStarts = map[token.TokenType]struct{}{
+	token.LET:      {},
+	token.RETURN:   {},
+	token.THROW:    {},
+	token.WHILE:    {},
+	token.FOR:      {},
+	token.BREAK:    {},
+	token.CONTINUE: {},
+}
+
 func (p *Parser) curPrecendence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
 		return p
@@ -125,40 +259,54 @@ func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
 
-func (p *Parser) expectPeek(t token.TokenType) bool {
-	if p.peekTokenIs(t) {
-		p.nextToken()
-		return true
-	} else {
+// expectPeek moves to the next token, which must be of type t.
+func (p *Parser) expectPeek(t token.TokenType) {
+	if !p.peekTokenIs(t) {
 		p.peekError(t)
-		return false
 	}
+	p.nextToken()
 }
 
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
+
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("Line %d: no prefix parse function for %s found", p.l.Line(), t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken.Pos, nil, "no prefix parse function for %s found", t)
 }
 
+// parseAssignExpression parses both plain and compound assignment. For a
+// compound assignment such as x += 1 the operator is kept without its
+// trailing =, so the node can be compiled as x = x + 1.
 func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
-	stmt := &ast.AssignStatement{Token: p.curToken}
+	tok := p.curToken
+	operator := strings.TrimSuffix(tok.Literal, "=")
 
-	if name, ok := left.(*ast.Identifier); ok {
-		stmt.Name = name
-	} else {
-		msg := fmt.Sprintf("Line %d: expected assign token to be IDENT, got %s instead.", p.l.Line(), name.TokenLiteral())
-		p.errors = append(p.errors, msg)
+	switch left := left.(type) {
+	case *ast.Identifier:
+		stmt := &ast.AssignStatement{Token: tok, Name: left, Operator: operator}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+		return stmt
+	case *ast.IndexExpression:
+		stmt := &ast.IndexAssignStatement{Token: tok, Target: left, Operator: operator}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+		return stmt
+	default:
+		p.errorf(tok.Pos, []token.TokenType{token.IDENT}, "expected assign token to be IDENT, got %s instead.", left.TokenLiteral())
+		return nil
 	}
-	p.nextToken()
-
-	stmt.Value = p.parseExpression(LOWEST)
-
-	return stmt
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -167,12 +315,16 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	p.nextToken()
 
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
+	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			p.errorf(p.curToken.Pos, []token.TokenType{token.RBRACE}, "expected %s to close the block, got %s instead", token.RBRACE, token.EOF)
+		}
+
+		stmt, ok := p.parseStatementOrRecover()
+		if ok {
 			block.Statements = append(block.Statements, stmt)
+			p.nextToken()
 		}
-		p.nextToken()
 	}
 	return block
 }
@@ -189,6 +341,16 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 
@@ -197,12 +359,21 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpression(precendence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
 	}
 
 	leftExp := prefix()
@@ -238,9 +409,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
-		return nil
-	}
+	p.expectPeek(end)
 
 	return list
 }
@@ -266,23 +435,19 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		key := p.parseExpression(LOWEST)
 
-		if !p.expectPeek(token.COLON) {
-			return nil
-		}
+		p.expectPeek(token.COLON)
 
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
 
-		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
-			return nil
+		if !p.peekTokenIs(token.RBRACE) {
+			p.expectPeek(token.COMMA)
 		}
 	}
 
-	if !p.expectPeek(token.RBRACE) {
-		return nil
-	}
+	p.expectPeek(token.RBRACE)
 
 	return hash
 }
@@ -292,25 +457,60 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 	p.nextToken()
 	idx.Index = p.parseExpression(LOWEST)
-	if !p.expectPeek(token.RBRACKET) {
-		return nil
-	}
+	p.expectPeek(token.RBRACKET)
 
 	return idx
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+
+	if err != nil {
+		p.errorf(p.curToken.Pos, nil, "could not parse %q as float", p.curToken.Literal)
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	p.expectPeek(token.LPAREN)
+
+	p.expectPeek(token.IDENT)
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.expectPeek(token.IN)
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	p.expectPeek(token.RPAREN)
+
+	p.expectPeek(token.LBRACE)
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
-		return nil
-	}
+	p.expectPeek(token.LPAREN)
 
 	lit.Parameters = p.parseFunctionParameters()
 
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
+	p.expectPeek(token.LBRACE)
 
 	lit.Body = p.parseBlockStatement()
 
@@ -325,20 +525,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	p.expectPeek(token.IDENT)
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		p.expectPeek(token.IDENT)
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
-	}
+	p.expectPeek(token.RPAREN)
 
 	return identifiers
 }
@@ -348,9 +546,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 	exp := p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
-	}
+	p.expectPeek(token.RPAREN)
 
 	return exp
 }
@@ -362,29 +558,21 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
-		return nil
-	}
+	p.expectPeek(token.LPAREN)
 
 	p.nextToken()
 
 	expression.Condition = p.parseExpression(LOWEST)
-	if !p.expectPeek(token.RPAREN) {
-		return nil
-	}
+	p.expectPeek(token.RPAREN)
 
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
+	p.expectPeek(token.LBRACE)
 
 	expression.Consequence = p.parseBlockStatement()
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
-		if !p.expectPeek(token.LBRACE) {
-			return nil
-		}
+		p.expectPeek(token.LBRACE)
 
 		expression.Alternative = p.parseBlockStatement()
 	}
@@ -400,6 +588,26 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 
+	precedence := p.curPrecendence()
+	if p.curTokenIs(token.POWER) {
+		// ** is right associative, so 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+// parseLogicalExpression parses && and ||, or their keyword forms and and
+// or, which are given the same operator.
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: string(p.curToken.Type),
+		Left:     left,
+	}
+
 	precedence := p.curPrecendence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
@@ -413,9 +621,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
 	if err != nil {
-		msg := fmt.Sprintf("Line %d: couldf not parse %q as integer", p.l.Line(), p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.errorf(p.curToken.Pos, nil, "could not parse %q as integer", p.curToken.Literal)
 	}
 
 	lit.Value = value
@@ -426,15 +632,11 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	p.expectPeek(token.IDENT)
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	if !p.expectPeek(token.ASSIGN) {
-		return nil
-	}
+	p.expectPeek(token.ASSIGN)
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
@@ -443,7 +645,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		fl.Name = stmt.Name.Value
 	}
 
-	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -463,6 +665,43 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parsePrefixIncrement() ast.Expression {
+	expression := &ast.IncrementExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal[:1],
+		Prefix:   true,
+	}
+
+	p.nextToken()
+
+	expression.Target = p.parseExpression(PREFIX)
+	p.checkIncrementTarget(expression)
+
+	return expression
+}
+
+func (p *Parser) parsePostfixIncrement(left ast.Expression) ast.Expression {
+	expression := &ast.IncrementExpression{
+		Token:    p.curToken,
+		Target:   left,
+		Operator: p.curToken.Literal[:1],
+	}
+
+	p.checkIncrementTarget(expression)
+
+	return expression
+}
+
+// checkIncrementTarget reports an error unless ++ or -- is applied to
+// something that can be assigned to.
+func (p *Parser) checkIncrementTarget(expression *ast.IncrementExpression) {
+	switch expression.Target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.errorf(expression.Token.Pos, []token.TokenType{token.IDENT}, "cannot apply %s to %s", expression.Token.Literal, expression.Target.String())
+	}
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -482,6 +721,16 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -491,35 +740,105 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	p.expectPeek(token.LBRACE)
+
+	expression.Block = p.parseBlockStatement()
+
+	p.expectPeek(token.CATCH)
+
+	p.expectPeek(token.LPAREN)
+
+	p.expectPeek(token.IDENT)
+
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.expectPeek(token.RPAREN)
+
+	p.expectPeek(token.LBRACE)
+
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
 func (p *Parser) parseUseLiteral() ast.Expression {
 	lit := &ast.UseLiteral{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
-		return nil
-	}
+	p.expectPeek(token.LPAREN)
 
 	v := p.parseExpression(LOWEST)
 	lit.Value = v
 
+	if p.noFileAccess {
+		return lit
+	}
+
 	input, err := ioutil.ReadFile(lit.Value.String())
 
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("Line %d: Could not read %s", p.l.Line(), lit.Value.String()))
+		p.errorf(lit.Token.Pos, nil, "Could not read %s", lit.Value.String())
 	}
 
-	subLexer := lexer.New(string(input))
+	subLexer := lexer.NewWithFilename(string(input), lit.Value.String())
 	subParser := New(subLexer)
 	lit.Body = subParser.ParseProgram()
+	p.errors = append(p.errors, subParser.Errors()...)
 
 	return lit
 }
 
+func (p *Parser) parseImportExpression() ast.Expression {
+	expression := &ast.ImportExpression{Token: p.curToken}
+
+	p.expectPeek(token.LPAREN)
+
+	p.expectPeek(token.STRING)
+	expression.Path = p.curToken.Literal
+
+	p.expectPeek(token.RPAREN)
+
+	return expression
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	p.expectPeek(token.LPAREN)
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	p.expectPeek(token.RPAREN)
+
+	p.expectPeek(token.LBRACE)
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("Line %d: expected next token to be %s, got %s instead",
-		p.l.Line(),
-		t,
-		p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken.Pos, []token.TokenType{t}, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) peekPrecedence() int {
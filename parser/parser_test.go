@@ -6,6 +6,7 @@ import (
 
 	"github.com/gilmae/monkey/ast"
 	"github.com/gilmae/monkey/lexer"
+	"github.com/gilmae/monkey/token"
 )
 
 func TestAssignStatement(t *testing.T) {
@@ -99,6 +100,37 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5e2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program does not have enough statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.ExpressionStatement, got %T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression not *ast.FloatLiteral, got %T", stmt.Expression)
+	}
+
+	if literal.Value != 250 {
+		t.Errorf("literal.Value not %f, got %f", 250.0, literal.Value)
+	}
+
+	if literal.TokenLiteral() != "2.5e2" {
+		t.Errorf("literal.TokenLiteral not %s, got %s", "2.5e2", literal.TokenLiteral())
+	}
+}
+
 func TestFunctionLiteralExpression(t *testing.T) {
 	input := "fn(x,y){x+y;}"
 
@@ -212,6 +244,52 @@ func TestFunctionParamaterParsing(t *testing.T) {
 	}
 }
 
+func TestLoopStatements(t *testing.T) {
+	input := "while (x < y) { x; break; } for (i in items) { continue; }"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program does not have 2 statements, got %d", len(program.Statements))
+	}
+
+	while, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.WhileStatement, got %T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, while.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(while.Body.Statements) != 2 {
+		t.Fatalf("while body is not 2 statements, got %d", len(while.Body.Statements))
+	}
+
+	if _, ok := while.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("while.Body.Statements[1] not *ast.BreakStatement, got %T", while.Body.Statements[1])
+	}
+
+	forStmt, ok := program.Statements[1].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] not *ast.ForStatement, got %T", program.Statements[1])
+	}
+
+	if !testIdentifier(t, forStmt.Name, "i") {
+		return
+	}
+
+	if !testIdentifier(t, forStmt.Iterable, "items") {
+		return
+	}
+
+	if _, ok := forStmt.Body.Statements[0].(*ast.ContinueStatement); !ok {
+		t.Errorf("forStmt.Body.Statements[0] not *ast.ContinueStatement, got %T", forStmt.Body.Statements[0])
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input             string
@@ -563,6 +641,42 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
+		{
+			"a and b or c and d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-a ** 2 * b",
+			"((-(a ** 2)) * b)",
+		},
+		{
+			"a | b ^ c & d << 1 + e",
+			"(a | (b ^ (c & (d << (1 + e)))))",
+		},
+		{
+			"a & b == c >> 2",
+			"((a & b) == (c >> 2))",
+		},
+		{
+			"~a & ~b",
+			"((~a) & (~b))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -823,6 +937,125 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"x += 1", "+", "x+=1"},
+		{"x -= y * 2", "-", "x-=(y * 2)"},
+		{"x *= 3", "*", "x*=3"},
+		{"x /= 4", "/", "x/=4"},
+		{"x %= 5", "%", "x%=5"},
+		{"x = 6", "", "x=6"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement, got %T", program.Statements[0])
+		}
+
+		stmt, ok := exp.Expression.(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("exp is not ast.AssignStatement, got %T", exp.Expression)
+		}
+
+		if stmt.Operator != tt.operator {
+			t.Errorf("wrong Operator, want=%q, got=%q", tt.operator, stmt.Operator)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong String(), want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestParsingIncrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x++", "(x++)"},
+		{"--x", "(--x)"},
+		{"a[i]--", "((a[i])--)"},
+		{"++a[i]", "(++(a[i]))"},
+		{"-x++", "(-(x++))"},
+		{"x++ + 1", "((x++) + 1)"},
+		{"1 + ++x * 2", "(1 + ((++x) * 2))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong String(), want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1++", "1:2: cannot apply ++ to 1"},
+		{"--f()", "1:1: cannot apply -- to f()"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0].String() != tt.expected {
+			t.Errorf("wrong errors for %q, want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1] = 2", "(a[1])=2"},
+		{`h["a"][0] = v + 1`, "((h[a])[0])=(v + 1)"},
+		{"a[i] += 2", "(a[i])+=2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has incorrect number of statements, got %d", len(program.Statements))
+		}
+
+		exp, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement, got %T", program.Statements[0])
+		}
+
+		stmt, ok := exp.Expression.(*ast.IndexAssignStatement)
+		if !ok {
+			t.Fatalf("exp is not ast.IndexAssignStatement, got %T", exp.Expression)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong String(), want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -942,6 +1175,69 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestThrowStatement(t *testing.T) {
+	input := `throw "oops";`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program does not have enough statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.ThrowStatement, got %T", program.Statements[0])
+	}
+
+	if stmt.Value.String() != "oops" {
+		t.Errorf("stmt.Value not %q, got %q", "oops", stmt.Value.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := "try { x } catch (e) { y }"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program does not have enough statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.ExpressionStatement, got %T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression not *ast.TryExpression, got %T", stmt.Expression)
+	}
+
+	if len(exp.Block.Statements) != 1 {
+		t.Errorf("block is not 1 statement, got %d", len(exp.Block.Statements))
+	}
+
+	if !testIdentifier(t, exp.Param, "e") {
+		return
+	}
+
+	if len(exp.Handler.Statements) != 1 {
+		t.Errorf("handler is not 1 statement, got %d", len(exp.Handler.Statements))
+	}
+
+	for _, input := range []string{"try { x }", "try { x } catch { y }", "try { x } catch (1) { y }"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestUseLiteralExpression(t *testing.T) {
 	input := `use("foobar")`
 	l := lexer.New(input)
@@ -1116,8 +1412,189 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser as %d errors", len(errors))
 	for _, msg := range errors {
-		t.Errorf("Parser error: %q", msg)
+		t.Errorf("Parser error: %q", msg.String())
 	}
 
 	t.FailNow()
 }
+
+func TestImportExpression(t *testing.T) {
+	input := `let strings = import("lib/strings");`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program does not have 1 statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.LetStatement, got %T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Value not *ast.ImportExpression, got %T", stmt.Value)
+	}
+
+	if exp.Path != "lib/strings" {
+		t.Errorf("exp.Path not %q, got %q", "lib/strings", exp.Path)
+	}
+
+	if exp.String() != `import("lib/strings")` {
+		t.Errorf("exp.String() wrong, got %q", exp.String())
+	}
+
+	p = New(lexer.New(`import(name)`))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for an import without a string literal")
+	}
+}
+
+func TestProgramExports(t *testing.T) {
+	input := `let a = 1; let _hidden = 2; b = 3; let c = fn() { let d = 4 }; let a = 5;`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	exports := program.Exports()
+	if len(exports) != 2 || exports[0] != "a" || exports[1] != "c" {
+		t.Errorf("wrong exports, want=[a c], got=%v", exports)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements []string
+	}{
+		{
+			`let x = ; let y = 2; y`,
+			[]string{"1:9: no prefix parse function for ; found"},
+			[]string{"let y = 2;", "y"},
+		},
+		{
+			`let = 1; let z 5; fn(a,) { }; 3`,
+			[]string{
+				"1:5: expected next token to be IDENT, got = instead",
+				"1:16: expected next token to be =, got INT instead",
+				"1:24: expected next token to be IDENT, got ) instead",
+			},
+			[]string{"3"},
+		},
+		{
+			`let a = (1 + ; a`,
+			[]string{"1:14: no prefix parse function for ; found"},
+			[]string{"a"},
+		},
+		{
+			`let f = fn() { let h = {1: }; h }; f`,
+			[]string{"1:28: no prefix parse function for } found"},
+			[]string{"let f = fn<f>()h;", "f"},
+		},
+		{
+			"while (x) { if (y) { break } else z; x }\nreturn 1",
+			[]string{"1:35: expected next token to be {, got IDENT instead"},
+			[]string{"whilex x", "return 1;"},
+		},
+		{
+			`} let x = 1;`,
+			[]string{"1:1: no prefix parse function for } found"},
+			[]string{"let x = 1;"},
+		},
+		{
+			`fn() { x`,
+			[]string{"1:9: expected } to close the block, got EOF instead"},
+			[]string{},
+		},
+		{
+			`1 = 2; 3`,
+			[]string{"1:3: expected assign token to be IDENT, got 1 instead."},
+			[]string{"3"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("%q: wrong number of errors, want=%d, got=%d (%v)", tt.input, len(tt.errors), len(errors), errors)
+			continue
+		}
+		for i, want := range tt.errors {
+			if errors[i].String() != want {
+				t.Errorf("%q: errors[%d] wrong, want=%q, got=%q", tt.input, i, want, errors[i].String())
+			}
+		}
+
+		if len(program.Statements) != len(tt.statements) {
+			t.Errorf("%q: wrong number of statements, want=%d, got=%d", tt.input, len(tt.statements), len(program.Statements))
+			continue
+		}
+		for i, want := range tt.statements {
+			if program.Statements[i].String() != want {
+				t.Errorf("%q: statements[%d] wrong, want=%q, got=%q", tt.input, i, want, program.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	p := New(lexer.NewWithFilename("let x 5;", "test.mk"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors, want=1, got=%d", len(errors))
+	}
+
+	d := errors[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity, want=%s, got=%s", SeverityError, d.Severity)
+	}
+
+	if d.Pos.File != "test.mk" || d.Pos.Line != 1 || d.Pos.Column != 7 {
+		t.Errorf("wrong position, got %s", d.Pos)
+	}
+
+	if d.Message != "expected next token to be =, got INT instead" {
+		t.Errorf("wrong message, got %q", d.Message)
+	}
+
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN {
+		t.Errorf("wrong expected tokens, want=[%s], got=%v", token.ASSIGN, d.Expected)
+	}
+}
+
+func TestMalformedProgramsHaveNoNilNodes(t *testing.T) {
+	inputs := []string{
+		`let`, `let x`, `let x =`, `return`, `throw`, `-`, `!`, `1 +`, `(1`, `[1, 2`, `{1: 2`, `{1 2}`,
+		`fn(`, `fn(x`, `fn(x) x`, `if`, `if (x`, `if (x) {`, `if (x) { y } else`, `a[1`, `f(1,`,
+		`while (x`, `for (x in`, `for (1 in y) {}`, `try { x } catch (e`, `import(`, `x = `,
+		`1.2.3`, `99999999999999999999`, `{ { {`, `} } }`, `;;;`,
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("String() of the AST for %q panicked: %v", input, r)
+				}
+			}()
+			_ = program.String()
+		}()
+	}
+}
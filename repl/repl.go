@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/gilmae/monkey/compiler"
 	"github.com/gilmae/monkey/lexer"
 	"github.com/gilmae/monkey/parser"
+	"github.com/gilmae/monkey/token"
 	"github.com/gilmae/monkey/vm"
 
 	"github.com/gilmae/monkey/object"
@@ -50,6 +52,12 @@ func Start(in io.Reader, out io.Writer) {
 		if line == "exit" {
 			break
 		}
+
+		if strings.HasPrefix(line, ":") {
+			runCommand(out, line, symbolTable, constants, globals)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -78,7 +86,14 @@ func Start(in io.Reader, out io.Writer) {
 		machine := vm.NewWithGlobalsStore(code, globals)
 		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "Executing bytecode failed:\n%s\n", err)
+			if _, ok := err.(*vm.ExitError); ok {
+				return
+			}
+			if rerr, ok := err.(*vm.RuntimeError); ok {
+				fmt.Fprintf(out, "Executing bytecode failed:\n%s\n", rerr.StackTrace())
+			} else {
+				fmt.Fprintf(out, "Executing bytecode failed:\n%s\n", err)
+			}
 			continue
 		}
 
@@ -89,11 +104,73 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+const COMMANDS = `:ast <code>      print the parsed program
+:dis <code>      print the bytecode the code compiles to
+:tokens <code>   print the tokens the lexer produces
+:globals         print the global variables and their values
+:help            print this message
+`
+
+// runCommand handles a REPL meta-command. Commands only inspect the
+// session; they never define or change anything in it.
+func runCommand(out io.Writer, line string, symbolTable *compiler.SymbolTable, constants []object.Object, globals []object.Object) {
+	name, input := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		name, input = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":tokens":
+		l := lexer.New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			fmt.Fprintf(out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		}
+	case ":ast":
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			return
+		}
+		fmt.Fprintf(out, "%s\n", program.String())
+	case ":dis":
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			return
+		}
+
+		comp := compiler.NewWithState(symbolTable.Copy(), constants[:len(constants):len(constants)])
+		err := comp.Compile(program)
+		if err != nil {
+			fmt.Fprintf(out, "Compile error:\n%s\n", err)
+			return
+		}
+		compiler.Disassemble(out, comp.Bytecode())
+	case ":globals":
+		for _, s := range symbolTable.Symbols() {
+			if s.Scope != compiler.GlobalScope {
+				continue
+			}
+			value := "null"
+			if globals[s.Index] != nil {
+				value = globals[s.Index].Inspect()
+			}
+			fmt.Fprintf(out, "%s = %s\n", s.Name, value)
+		}
+	case ":help":
+		io.WriteString(out, COMMANDS)
+	default:
+		fmt.Fprintf(out, "unknown command %s, try :help\n", name)
+	}
+}
+
+func printParserErrors(out io.Writer, errors []parser.Diagnostic) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Some errors were found in your code.\n")
 	io.WriteString(out, "== parser errors ==.\n")
 	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+		io.WriteString(out, "\t"+msg.String()+"\n")
 	}
 }
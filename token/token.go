@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 // TokenType defines what type a Token is
 type TokenType string
 
@@ -7,6 +9,28 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position identifies where a token starts in its source. Line and Column
+// are 1-based; File is empty for source that did not come from a file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position has been set
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.File != "" {
+		s = p.File + ":" + s
+	}
+	return s
 }
 
 const (
@@ -15,15 +39,37 @@ const (
 
 	IDENT = "IDENT"
 	INT   = "INT"
+	FLOAT = "FLOAT"
 
 	ASSIGN  = "="
 	PLUS    = "+"
 	MINUS   = "-"
 	ASTERIX = "*"
 	FSLASH  = "/"
+	PERCENT = "%"
+	POWER   = "**"
+
+	PLUSASSIGN    = "+="
+	MINUSASSIGN   = "-="
+	ASTERIXASSIGN = "*="
+	FSLASHASSIGN  = "/="
+	PERCENTASSIGN = "%="
+
+	INCREMENT = "++"
+	DECREMENT = "--"
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	SHL       = "<<"
+	SHR       = ">>"
 
 	BANG = "!"
 
+	AND = "&&"
+	OR  = "||"
+
 	EQ    = "=="
 	NOTEQ = "!="
 
@@ -52,17 +98,37 @@ const (
 	RETURN   = "RETURN"
 	STRING   = "STRING"
 	USE      = "USE"
+	IMPORT   = "IMPORT"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	THROW    = "THROW"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
-	"use":    USE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"use":      USE,
+	"import":   IMPORT,
+	"and":      AND,
+	"or":       OR,
+	"try":      TRY,
+	"catch":    CATCH,
+	"throw":    THROW,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 // LookupIdent checks if an identifier is a keyword or a user identifier
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gilmae/monkey/object"
+	"github.com/gilmae/monkey/token"
+)
+
+// TraceFrame describes one active call frame at the point a runtime error
+// occurred.
+type TraceFrame struct {
+	Function string
+	Offset   int
+	Pos      token.Position
+}
+
+func (tf TraceFrame) String() string {
+	if tf.Pos.IsValid() {
+		return fmt.Sprintf("%s (%s)", tf.Function, tf.Pos)
+	}
+	return fmt.Sprintf("%s (offset %04d)", tf.Function, tf.Offset)
+}
+
+// Exception is raised by a throw statement and carries the thrown value.
+type Exception struct {
+	Value object.Object
+}
+
+func (e *Exception) Error() string {
+	if err, ok := e.Value.(*object.Error); ok {
+		return err.Message
+	}
+	return "uncaught exception: " + e.Value.Inspect()
+}
+
+// ExitError is returned by Run and Call when the program calls `exit`. It
+// stops the VM without running any enclosing catch blocks.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// isFatal reports whether err must stop the VM rather than being caught by
+// a try block.
+func isFatal(err error) bool {
+	switch err.(type) {
+	case *LimitError, *ExitError:
+		return true
+	}
+	return false
+}
+
+// RuntimeError is returned by Run when execution fails. Trace lists the
+// active frames, innermost first, and Pos is the source position of the
+// failing instruction when it is known.
+type RuntimeError struct {
+	Message string
+	Pos     token.Position
+	Trace   []TraceFrame
+
+	cause error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error that caused the failure, such as a *LimitError.
+func (e *RuntimeError) Unwrap() error {
+	return e.cause
+}
+
+// StackTrace returns the error message followed by one line per frame.
+func (e *RuntimeError) StackTrace() string {
+	var out bytes.Buffer
+
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String() + ": ")
+	}
+	out.WriteString(e.Message)
+	for _, f := range e.Trace {
+		out.WriteString("\n\tat ")
+		out.WriteString(f.String())
+	}
+
+	return out.String()
+}
+
+// runError converts an error that stopped Run or Call into the error they
+// return.
+func (v *VM) runError(err error) error {
+	if exit, ok := err.(*ExitError); ok {
+		return exit
+	}
+	return v.newRuntimeError(err)
+}
+
+func (v *VM) newRuntimeError(err error) *RuntimeError {
+	trace := make([]TraceFrame, 0, v.framesIndex)
+
+	for i := v.framesIndex - 1; i >= 0; i-- {
+		frame := v.frames[i]
+
+		name := frame.cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		if i == 0 {
+			name = "<main>"
+		}
+
+		offset := frame.ip
+		if offset < 0 {
+			offset = 0
+		}
+
+		pos, _ := frame.cl.Fn.SourceMap.Lookup(offset)
+
+		trace = append(trace, TraceFrame{Function: name, Offset: offset, Pos: pos})
+	}
+
+	return &RuntimeError{Message: err.Error(), Pos: trace[0].Pos, Trace: trace, cause: err}
+}
+
+// errorObject converts an error raised while running a callback back into
+// the object a builtin returns, keeping any thrown value.
+func errorObject(err error) *object.Error {
+	if exception, ok := err.(*Exception); ok {
+		if obj, ok := exception.Value.(*object.Error); ok {
+			return obj
+		}
+		return &object.Error{Message: exception.Error(), Value: exception.Value}
+	}
+	return &object.Error{Message: err.Error()}
+}
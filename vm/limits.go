@@ -0,0 +1,181 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gilmae/monkey/object"
+)
+
+// Limits bounds the resources a VM may use while running untrusted code.
+// A zero field means no limit beyond the VM's fixed StackSize and
+// MaxFrames.
+type Limits struct {
+	// MaxInstructions is the number of instructions Run or Call may
+	// execute.
+	MaxInstructions int64
+	// MaxFrames is the deepest the call stack may grow.
+	MaxFrames int
+	// MaxElements is the largest array or hash a program may create.
+	MaxElements int
+	// MaxStringLength is the longest string, in bytes, a program may
+	// create.
+	MaxStringLength int
+	// Timeout is how long Run or Call may take.
+	Timeout time.Duration
+}
+
+// LimitKind identifies the limit that stopped a VM.
+type LimitKind int
+
+const (
+	LimitInstructions LimitKind = iota
+	LimitFrames
+	LimitStack
+	LimitElements
+	LimitStringLength
+	LimitTimeout
+	LimitCancelled
+)
+
+// LimitError is the cause of the *RuntimeError returned when a VM exceeds
+// one of its limits or its context is cancelled. Unlike other errors it
+// can't be caught by a try block.
+type LimitError struct {
+	Kind    LimitKind
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// contextCheckInterval is how many instructions are run between checks of
+// the context.
+const contextCheckInterval = 1024
+
+// SetLimits sets the limits applied to later calls to Run and Call.
+func (v *VM) SetLimits(limits Limits) {
+	v.limits = limits
+}
+
+// SetContext sets a context whose cancellation stops Run and Call.
+func (v *VM) SetContext(ctx context.Context) {
+	v.ctx = ctx
+}
+
+// begin starts the instruction count and timeout for a call to Run or to
+// Call from outside the VM. The returned function must be called when it
+// finishes.
+func (v *VM) begin() func() {
+	v.active++
+	if v.active > 1 {
+		return func() { v.active-- }
+	}
+
+	v.instructions = 0
+	v.aborted = nil
+
+	ctx := v.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cancel := func() {}
+	if v.limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.limits.Timeout)
+	}
+	v.running = ctx
+
+	return func() {
+		cancel()
+		v.running = nil
+		v.active--
+	}
+}
+
+// tick counts an executed instruction and checks the instruction budget
+// and, every so often, the context.
+func (v *VM) tick() error {
+	v.instructions++
+
+	if v.limits.MaxInstructions > 0 && v.instructions > v.limits.MaxInstructions {
+		return &LimitError{
+			Kind:    LimitInstructions,
+			Message: fmt.Sprintf("instruction limit exceeded: more than %d instructions", v.limits.MaxInstructions),
+		}
+	}
+
+	if v.running != nil && v.instructions%contextCheckInterval == 0 {
+		return v.checkContext()
+	}
+
+	return nil
+}
+
+func (v *VM) checkContext() error {
+	switch v.running.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return &LimitError{Kind: LimitTimeout, Message: "execution timed out"}
+	default:
+		return &LimitError{Kind: LimitCancelled, Message: "execution cancelled"}
+	}
+}
+
+// maxFrames is the deepest the call stack may grow.
+func (v *VM) maxFrames() int {
+	if v.limits.MaxFrames > 0 && v.limits.MaxFrames < MaxFrames {
+		return v.limits.MaxFrames
+	}
+	return MaxFrames
+}
+
+// checkSize returns an error if obj is larger than the limits allow.
+func (v *VM) checkSize(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return v.checkLength(object.ARRAY_OBJ, int64(len(obj.Elements)))
+	case *object.Hash:
+		return v.checkLength(object.HASH_OBJ, int64(len(obj.Pairs)))
+	case *object.String:
+		return v.checkLength(object.STRING_OBJ, int64(len(obj.Value)))
+	}
+	return nil
+}
+
+// checkBuiltinSize returns an error if the value fn would build from args
+// is larger than the limits allow, before fn builds it.
+func (v *VM) checkBuiltinSize(fn *object.Builtin, args []object.Object) error {
+	if fn.Size == nil {
+		return nil
+	}
+	return v.checkLength(fn.Size(args...))
+}
+
+// checkLength returns an error if a value of type typ with the given size,
+// in bytes for a string or elements otherwise, is larger than the limits
+// allow.
+func (v *VM) checkLength(typ object.ObjectType, size int64) error {
+	max, kind := v.limits.MaxElements, LimitElements
+	if typ == object.STRING_OBJ {
+		max, kind = v.limits.MaxStringLength, LimitStringLength
+	}
+
+	if max <= 0 || size <= int64(max) {
+		return nil
+	}
+
+	if kind == LimitStringLength {
+		return &LimitError{
+			Kind:    kind,
+			Message: fmt.Sprintf("string length limit exceeded: %d bytes, limit is %d", size, max),
+		}
+	}
+	return &LimitError{
+		Kind:    kind,
+		Message: fmt.Sprintf("element limit exceeded: %d elements, limit is %d", size, max),
+	}
+}
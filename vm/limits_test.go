@@ -0,0 +1,252 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gilmae/monkey/compiler"
+	"github.com/gilmae/monkey/object"
+)
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		ctx      context.Context
+		expected LimitKind
+		message  string
+	}{
+		{
+			input:    "while (true) { }",
+			limits:   Limits{MaxInstructions: 1000},
+			expected: LimitInstructions,
+			message:  "instruction limit exceeded: more than 1000 instructions",
+		},
+		{
+			input:    "let f = fn() { f() }; f()",
+			limits:   Limits{MaxInstructions: 1000},
+			expected: LimitInstructions,
+			message:  "instruction limit exceeded: more than 1000 instructions",
+		},
+		{
+			input:    "try { while (true) { } } catch (e) { 1 }",
+			limits:   Limits{MaxInstructions: 1000},
+			expected: LimitInstructions,
+			message:  "instruction limit exceeded: more than 1000 instructions",
+		},
+		{
+			input:    "try { map([1], fn(x) { while (true) { } }) } catch (e) { 1 }",
+			limits:   Limits{MaxInstructions: 1000},
+			expected: LimitInstructions,
+			message:  "instruction limit exceeded: more than 1000 instructions",
+		},
+		{
+			input:    "let f = fn() { 1 + f() }; f()",
+			limits:   Limits{MaxFrames: 50},
+			expected: LimitFrames,
+			message:  "frame overflow: more than 50 nested calls",
+		},
+		{
+			input:    "let f = fn() { 1 + f() }; f()",
+			expected: LimitFrames,
+			message:  "frame overflow: more than 1024 nested calls",
+		},
+		{
+			input:    "let f = fn(n) { let a = 1; let b = 2; let c = 3; let d = 4; let e = 5; let g = 6; 1 + f(n + 1) }; f(0)",
+			expected: LimitStack,
+			message:  "stack overflow",
+		},
+		{
+			input:    "[" + strings.Repeat("fn() { 1 }, ", StackSize) + "fn() { 1 }]",
+			expected: LimitStack,
+			message:  "stack overflow",
+		},
+		{
+			input:    "while (true) { }",
+			limits:   Limits{Timeout: 20 * time.Millisecond},
+			expected: LimitTimeout,
+			message:  "execution timed out",
+		},
+		{
+			input:    "while (true) { }",
+			ctx:      cancelled,
+			expected: LimitCancelled,
+			message:  "execution cancelled",
+		},
+		{
+			input:    "[1, 2, 3, 4]",
+			limits:   Limits{MaxElements: 3},
+			expected: LimitElements,
+			message:  "element limit exceeded: 4 elements, limit is 3",
+		},
+		{
+			input:    "let a = []; while (true) { a = push(a, 1) }",
+			limits:   Limits{MaxElements: 100},
+			expected: LimitElements,
+			message:  "element limit exceeded: 101 elements, limit is 100",
+		},
+		{
+			input:    `{"a": 1, "b": 2}`,
+			limits:   Limits{MaxElements: 1},
+			expected: LimitElements,
+			message:  "element limit exceeded: 2 elements, limit is 1",
+		},
+		{
+			input:    `let s = "ab"; while (true) { s = s + s }`,
+			limits:   Limits{MaxStringLength: 1000},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 1024 bytes, limit is 1000",
+		},
+		{
+			input:    `try { repeat("a", 20) } catch (e) { 1 }`,
+			limits:   Limits{MaxStringLength: 10},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 20 bytes, limit is 10",
+		},
+		{
+			input:    `repeat("a", 1000000000000)`,
+			limits:   Limits{MaxStringLength: 1000},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 1000000000000 bytes, limit is 1000",
+		},
+		{
+			input:    `repeat("ab", 4611686018427387904)`,
+			limits:   Limits{MaxStringLength: 1000},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 9223372036854775807 bytes, limit is 1000",
+		},
+		{
+			input:    `try { read_bytes(open("limits_test.go"), 9223372036854775807) } catch (e) { 1 }`,
+			limits:   Limits{MaxStringLength: 1000},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 9223372036854775807 bytes, limit is 1000",
+		},
+		{
+			input:    `map([1], fn(n) { repeat("a", 1000000000000) })`,
+			limits:   Limits{MaxStringLength: 1000},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 1000000000000 bytes, limit is 1000",
+		},
+		{
+			input:    `join(["aaaa", "bbbb", "cccc"], "--")`,
+			limits:   Limits{MaxStringLength: 15},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 16 bytes, limit is 15",
+		},
+		{
+			input:    `replace("aaaa", "a", "bbbb")`,
+			limits:   Limits{MaxStringLength: 15},
+			expected: LimitStringLength,
+			message:  "string length limit exceeded: 16 bytes, limit is 15",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		if tt.ctx != nil {
+			vm.SetContext(tt.ctx)
+		}
+
+		err = vm.Run()
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%q: expected a *LimitError, got %T (%v)", tt.input, err, err)
+			continue
+		}
+
+		if limitErr.Kind != tt.expected {
+			t.Errorf("%q: wrong limit kind, want=%d, got=%d", tt.input, tt.expected, limitErr.Kind)
+		}
+
+		if err.Error() != tt.message {
+			t.Errorf("%q: wrong message, want=%q, got=%q", tt.input, tt.message, err.Error())
+		}
+	}
+}
+
+func TestLimitsApplyToEachRun(t *testing.T) {
+	program := parse("let f = fn(n) { let i = 0; while (i < n) { i = i + 1 }; i }; f")
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetLimits(Limits{MaxInstructions: 500})
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	f := vm.LastPoppedStackElem()
+
+	// Each call gets a fresh budget
+	for i := 0; i < 3; i++ {
+		result, err := vm.Call(f.(*object.Closure), &object.Integer{Value: 20})
+		if err != nil {
+			t.Fatalf("call %d failed: %s", i, err)
+		}
+		testExpectedObject(t, 20, result)
+	}
+
+	_, err = vm.Call(f.(*object.Closure), &object.Integer{Value: 1000})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitInstructions {
+		t.Errorf("expected instruction limit error, got %T (%v)", err, err)
+	}
+}
+
+func TestElementLimitLeavesHashUnchanged(t *testing.T) {
+	program := parse(`let h = {"a": 1, "b": 1}; let set = fn(k) { h[k] = 2 }; [h, set]`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetLimits(Limits{MaxElements: 2})
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result := vm.LastPoppedStackElem().(*object.Array)
+	h := result.Elements[0].(*object.Hash)
+	set := result.Elements[1].(*object.Closure)
+
+	// Replacing an existing key doesn't grow the hash
+	_, err = vm.Call(set, &object.String{Value: "a"})
+	if err != nil {
+		t.Fatalf("replacing a key failed: %s", err)
+	}
+
+	_, err = vm.Call(set, &object.String{Value: "c"})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitElements {
+		t.Fatalf("expected element limit error, got %T (%v)", err, err)
+	}
+
+	if len(h.Pairs) != 2 {
+		t.Errorf("hash grew past the limit, got %d pairs", len(h.Pairs))
+	}
+}
@@ -1,16 +1,19 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/gilmae/monkey/code"
 	"github.com/gilmae/monkey/compiler"
 	"github.com/gilmae/monkey/object"
 )
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 const StackSize = 2048
 const GlobalSize = 65536
@@ -26,10 +29,34 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	handlers []handler
+
+	// stopFrame is the number of frames below the function being run by
+	// Call; run returns once that function has returned.
+	stopFrame int
+
+	limits       Limits
+	ctx          context.Context
+	running      context.Context // ctx with the timeout applied, while running
+	active       int             // nesting depth of Run and Call
+	instructions int64
+	aborted      error // the limit or exit that stopped a callback, if any
+}
+
+// handler records an active try block: where its catch block starts and
+// the frame and stack height to unwind to when an error is raised.
+type handler struct {
+	framesIndex int
+	sp          int
+	catchIP     int
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -55,12 +82,90 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// Run executes the bytecode. A failure not caught by a try block is
+// returned as a *RuntimeError carrying the call stack at the point of
+// failure, and a call to `exit` as an *ExitError.
 func (v *VM) Run() error {
+	defer v.begin()()
+
+	for {
+		err := v.run()
+		if err == nil {
+			return nil
+		}
+
+		if isFatal(err) || !v.handleError(err) {
+			return v.runError(err)
+		}
+	}
+}
+
+// Call runs a closure to completion with the VM's globals and returns its
+// result. It can be used once Run has finished, or by a builtin while Run
+// is in progress. A failure not caught inside the closure is returned as a
+// *RuntimeError and leaves the VM as it was before the call.
+func (v *VM) Call(cl *object.Closure, args ...object.Object) (object.Object, error) {
+	defer v.begin()()
+
+	result, rerr := v.call(cl, args)
+	if rerr != nil {
+		return nil, v.runError(rerr.cause)
+	}
+	return result, nil
+}
+
+func (v *VM) call(cl *object.Closure, args []object.Object) (object.Object, *RuntimeError) {
+	if v.aborted != nil {
+		return nil, v.newRuntimeError(v.aborted)
+	}
+
+	framesIndex, sp, handlers := v.framesIndex, v.sp, len(v.handlers)
+
+	outerStop := v.stopFrame
+	v.stopFrame = framesIndex
+	defer func() { v.stopFrame = outerStop }()
+
+	err := v.push(cl)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = v.push(args[i])
+	}
+	if err == nil {
+		err = v.callClosure(cl, len(args))
+	}
+
+	for err == nil && v.framesIndex > framesIndex {
+		err = v.run()
+		// Only try blocks entered during this call may catch its errors
+		if err != nil && !isFatal(err) && len(v.handlers) > handlers && v.handleError(err) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		if isFatal(err) {
+			v.aborted = err
+		}
+
+		rerr := v.newRuntimeError(err)
+		v.framesIndex, v.sp = framesIndex, sp
+		v.handlers = v.handlers[:handlers]
+		return nil, rerr
+	}
+
+	return v.pop(), nil
+}
+
+func (v *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+	for v.framesIndex > v.stopFrame && v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+		err := v.tick()
+		if err != nil {
+			return err
+		}
+
 		v.currentFrame().ip++
 
 		ip = v.currentFrame().ip
@@ -86,7 +191,8 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := v.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -106,8 +212,23 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpBitNot:
+			err := v.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
 		case code.OpPop:
 			v.pop()
+		case code.OpDuplicatePair:
+			err := v.push(v.stack[v.sp-2])
+			if err != nil {
+				return err
+			}
+
+			err = v.push(v.stack[v.sp-2])
+			if err != nil {
+				return err
+			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			v.currentFrame().ip = pos - 1
@@ -140,9 +261,14 @@ func (v *VM) Run() error {
 			v.currentFrame().ip += 2
 
 			array := v.buildArray(v.sp-numElements, v.sp)
+			err := v.checkSize(array)
+			if err != nil {
+				return err
+			}
+
 			v.sp = v.sp - numElements
 
-			err := v.push(array)
+			err = v.push(array)
 			if err != nil {
 				return err
 			}
@@ -151,6 +277,9 @@ func (v *VM) Run() error {
 			v.currentFrame().ip += 2
 
 			hash, err := v.buildHash(v.sp-numElements, v.sp)
+			if err == nil {
+				err = v.checkSize(hash)
+			}
 			if err != nil {
 				return err
 			}
@@ -169,18 +298,37 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSetIndex:
+			value := v.pop()
+			index := v.pop()
+			left := v.pop()
+
+			err := v.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := code.ReadUint8((ins[ip+1:]))
 			v.currentFrame().ip += 1
 
 			err := v.executeCall(int(numArgs))
 
+			if err != nil {
+				return err
+			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8((ins[ip+1:]))
+			v.currentFrame().ip += 1
+
+			err := v.executeTailCall(int(numArgs))
+
 			if err != nil {
 				return err
 			}
 		case code.OpReturnValue:
 			returnValue := v.pop()
 			frame := v.popFrame()
+			v.discardHandlers()
 			v.sp = frame.basePointer - 1
 			err := v.push(returnValue)
 			if err != nil {
@@ -188,6 +336,7 @@ func (v *VM) Run() error {
 			}
 		case code.OpReturn:
 			frame := v.popFrame()
+			v.discardHandlers()
 			v.sp = frame.basePointer - 1
 			err := v.push(Null)
 			if err != nil {
@@ -199,7 +348,12 @@ func (v *VM) Run() error {
 
 			frame := v.currentFrame()
 
-			v.stack[frame.basePointer+int(localIndex)] = v.pop()
+			slot := frame.basePointer + int(localIndex)
+			if cell, ok := v.stack[slot].(*object.Cell); ok {
+				cell.Value = v.pop()
+			} else {
+				v.stack[slot] = v.pop()
+			}
 
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
@@ -207,7 +361,29 @@ func (v *VM) Run() error {
 
 			frame := v.currentFrame()
 
-			err := v.push(v.stack[frame.basePointer+int(localIndex)])
+			local := v.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := local.(*object.Cell); ok {
+				local = cell.Value
+			}
+
+			err := v.push(local)
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			v.currentFrame().ip += 1
+
+			frame := v.currentFrame()
+
+			slot := frame.basePointer + int(localIndex)
+			cell, ok := v.stack[slot].(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: v.stack[slot]}
+				v.stack[slot] = cell
+			}
+
+			err := v.push(cell)
 			if err != nil {
 				return err
 			}
@@ -226,28 +402,125 @@ func (v *VM) Run() error {
 			v.currentFrame().ip += 3
 			err := v.pushClosure(int(constIndex), int(numFree))
 			if err != nil {
-				return nil
+				return err
+			}
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			globalIndex := code.ReadUint16(ins[ip+3:])
+			v.currentFrame().ip += 4
+			err := v.executeImport(int(constIndex), int(globalIndex))
+			if err != nil {
+				return err
 			}
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			v.currentFrame().ip += 1
 
+			currentClosure := v.currentFrame().cl
+			err := v.push(currentClosure.Free[freeIndex].Value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			v.currentFrame().ip += 1
+
+			currentClosure := v.currentFrame().cl
+			currentClosure.Free[freeIndex].Value = v.pop()
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			v.currentFrame().ip += 1
+
 			currentClosure := v.currentFrame().cl
 			err := v.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
 			}
+		case code.OpTry:
+			catchIP := int(code.ReadUint16(ins[ip+1:]))
+			v.currentFrame().ip += 2
+
+			v.handlers = append(v.handlers, handler{
+				framesIndex: v.framesIndex,
+				sp:          v.sp,
+				catchIP:     catchIP,
+			})
+		case code.OpEndTry:
+			v.handlers = v.handlers[:len(v.handlers)-1]
+		case code.OpThrow:
+			return &Exception{Value: v.pop()}
+		case code.OpIterator:
+			iterable := v.pop()
+
+			iterator, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			err := v.push(iterator)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			iterator := v.pop().(*object.Iterator)
+
+			el, ok := iterator.Next()
+			if ok {
+				err := v.push(el)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := v.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
 		case code.OpCurrentClosure:
 			currentClosure := v.currentFrame().cl
 			err := v.push(currentClosure)
 			if err != nil {
 				return err
 			}
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
 		}
 	}
 	return nil
 }
 
+// handleError unwinds to the innermost active try block, if there is one,
+// and pushes the caught value for its catch block.
+func (v *VM) handleError(err error) bool {
+	if len(v.handlers) == 0 {
+		return false
+	}
+
+	h := v.handlers[len(v.handlers)-1]
+	v.handlers = v.handlers[:len(v.handlers)-1]
+
+	v.framesIndex = h.framesIndex
+	v.sp = h.sp
+	v.currentFrame().ip = h.catchIP - 1
+
+	var caught object.Object
+	if exception, ok := err.(*Exception); ok {
+		caught = exception.Value
+	} else {
+		caught = &object.Error{Message: err.Error()}
+	}
+
+	return v.push(caught) == nil
+}
+
+// discardHandlers drops the try blocks belonging to frames that have
+// returned.
+func (v *VM) discardHandlers() {
+	for len(v.handlers) > 0 && v.handlers[len(v.handlers)-1].framesIndex > v.framesIndex {
+		v.handlers = v.handlers[:len(v.handlers)-1]
+	}
+}
+
 func (v *VM) LastPoppedStackElem() object.Object {
 	return v.stack[v.sp]
 }
@@ -294,15 +567,58 @@ func (v *VM) callClosure(cl *object.Closure, numArgs int) error {
 	}
 
 	frame := NewFrame(cl, v.sp-numArgs)
-	v.pushFrame(frame)
+	if frame.basePointer+cl.Fn.NumLocals > StackSize {
+		return &LimitError{Kind: LimitStack, Message: "stack overflow"}
+	}
+
+	err := v.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 	v.sp = frame.basePointer + cl.Fn.NumLocals
 
+	// Clear any cells left in the local slots by a previous frame, so that
+	// setting a local never writes through to another closure's variable.
+	for i := frame.basePointer + numArgs; i < v.sp; i++ {
+		v.stack[i] = nil
+	}
+
 	return nil
 }
 
 func (v *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
 	args := v.stack[v.sp-numArgs : v.sp]
-	result := fn.Fn(args...)
+
+	if err := v.checkBuiltinSize(fn, args); err != nil {
+		return err
+	}
+
+	var result object.Object
+	if fn.CallerFn != nil {
+		// Copy the arguments, as callbacks reuse the stack above them
+		result = fn.CallerFn(caller{v}, append([]object.Object{}, args...)...)
+	} else {
+		result = fn.Fn(args...)
+	}
+
+	if v.aborted != nil {
+		return v.aborted
+	}
+
+	if exit, ok := result.(*object.Exit); ok {
+		return &ExitError{Code: exit.Code}
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		if err.Value != nil {
+			return &Exception{Value: err.Value}
+		}
+		return errors.New(err.Message)
+	}
+
+	if err := v.checkSize(result); err != nil {
+		return err
+	}
 
 	v.sp = v.sp - numArgs - 1
 
@@ -315,6 +631,66 @@ func (v *VM) callBuiltin(fn *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// executeImport pushes the value of a module, running the module's
+// function the first time and caching the result in the given global.
+func (v *VM) executeImport(constIndex, globalIndex int) error {
+	if module := v.globals[globalIndex]; module != nil {
+		return v.push(module)
+	}
+
+	fn, ok := v.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a module: %+v", v.constants[constIndex])
+	}
+
+	module, rerr := v.call(&object.Closure{Fn: fn}, nil)
+	if rerr != nil {
+		return rerr.cause
+	}
+
+	v.globals[globalIndex] = module
+	return v.push(module)
+}
+
+// caller lets builtins call the functions they are passed on the VM that
+// is running them.
+type caller struct {
+	vm *VM
+}
+
+func (c caller) Call(fn object.Object, args ...object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		result, rerr := c.vm.call(fn, args)
+		if rerr != nil {
+			return errorObject(rerr.cause)
+		}
+		return result
+	case *object.Builtin:
+		if err := c.vm.checkBuiltinSize(fn, args); err != nil {
+			c.vm.aborted = err
+			return &object.Error{Message: err.Error()}
+		}
+
+		var result object.Object
+		if fn.CallerFn != nil {
+			result = fn.CallerFn(c, args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if exit, ok := result.(*object.Exit); ok {
+			c.vm.aborted = &ExitError{Code: exit.Code}
+			return &object.Error{Message: c.vm.aborted.Error()}
+		}
+		if result == nil {
+			return Null
+		}
+		return result
+	default:
+		return &object.Error{Message: "calling non-function and non-built-in"}
+	}
+}
+
 func (v *VM) executeBangOperator(op code.Opcode) error {
 	operand := v.pop()
 
@@ -339,6 +715,8 @@ func (v *VM) executeBinaryOperation(op code.Opcode) error {
 
 	if leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ {
 		return v.executeBinaryIntegerOperation(op, left, right)
+	} else if isNumeric(left) && isNumeric(right) {
+		return v.executeBinaryFloatOperation(op, left, right)
 	} else if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
 		return v.executeBinaryStringOperation(op, left, right)
 	}
@@ -358,7 +736,35 @@ func (v *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Ob
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return errDivisionByZero
+		}
 		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return errDivisionByZero
+		}
+		result = leftValue % rightValue
+	case code.OpPow:
+		if rightValue < 0 {
+			return v.push(&object.Float{Value: math.Pow(float64(leftValue), float64(rightValue))})
+		}
+		result = integerPower(leftValue, rightValue)
+	case code.OpBitAnd:
+		result = leftValue & rightValue
+	case code.OpBitOr:
+		result = leftValue | rightValue
+	case code.OpBitXor:
+		result = leftValue ^ rightValue
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d", rightValue)
+		}
+		if op == code.OpShiftLeft {
+			result = leftValue << uint64(rightValue)
+		} else {
+			result = leftValue >> uint64(rightValue)
+		}
 	default:
 		return fmt.Errorf("Unknown integer operator: %d", op)
 	}
@@ -366,6 +772,30 @@ func (v *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Ob
 
 }
 
+func (v *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	case code.OpPow:
+		result = math.Pow(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+	}
+	return v.push(&object.Float{Value: result})
+}
+
 func (v *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
@@ -373,11 +803,16 @@ func (v *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Obj
 	var result string
 	switch op {
 	case code.OpAdd:
+		err := v.checkLength(object.STRING_OBJ, int64(len(leftValue)+len(rightValue)))
+		if err != nil {
+			return err
+		}
 		result = leftValue + rightValue
 
 	default:
 		return fmt.Errorf("Unknown integer operator: %d", op)
 	}
+
 	return v.push(&object.String{Value: result})
 
 }
@@ -394,6 +829,39 @@ func (v *VM) executeCall(numArgs int) error {
 	}
 }
 
+// executeTailCall calls a function whose result the current frame returns
+// unchanged. A closure takes over the current frame instead of pushing a new
+// one; anything else is called normally and its result returned.
+func (v *VM) executeTailCall(numArgs int) error {
+	callee := v.stack[v.sp-1-numArgs]
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		err := v.executeCall(numArgs)
+		if err != nil {
+			return err
+		}
+
+		returnValue := v.pop()
+		frame := v.popFrame()
+		v.discardHandlers()
+		v.sp = frame.basePointer - 1
+		return v.push(returnValue)
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// Move the callee and its arguments down over the current frame.
+	frame := v.popFrame()
+	v.discardHandlers()
+	base := frame.basePointer - 1
+	copy(v.stack[base:], v.stack[v.sp-1-numArgs:v.sp])
+	v.sp = base + 1 + numArgs
+
+	return v.callClosure(cl, numArgs)
+}
+
 func (v *VM) executeComparison(op code.Opcode) error {
 	right := v.pop()
 	left := v.pop()
@@ -405,6 +873,14 @@ func (v *VM) executeComparison(op code.Opcode) error {
 		return v.executeIntegerComparison(op, left, right)
 	}
 
+	if isNumeric(left) && isNumeric(right) {
+		return v.executeFloatComparison(op, left, right)
+	}
+
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return v.executeStringComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
 		return v.push(nativeBoolToBooleanObject(right == left))
@@ -426,6 +902,29 @@ func (v *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+// executeSetIndex stores value in an array or hash and pushes it as the
+// value of the assignment.
+func (v *VM) executeSetIndex(left, index, value object.Object) error {
+	// Only a new hash key grows a collection. It is checked before being
+	// added, so a hash over the limit is left as it was.
+	if hash, ok := left.(*object.Hash); ok {
+		if key, ok := index.(object.Hashable); ok {
+			if _, exists := hash.Pairs[key.HashKey()]; !exists {
+				err := v.checkLength(object.HASH_OBJ, int64(len(hash.Pairs))+1)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := object.SetIndex(left, index, value); err != nil {
+		return errors.New(err.Message)
+	}
+
+	return v.push(value)
+}
+
 func (v *VM) executeArrayIndexExpression(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
 	i := index.(*object.Integer).Value
@@ -473,14 +972,96 @@ func (v *VM) executeIntegerComparison(op code.Opcode, left, right object.Object)
 	}
 }
 
+func (v *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return v.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (v *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return v.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
 func (v *VM) executeMinusOperator(op code.Opcode) error {
 	operand := v.pop()
-	if operand.Type() != object.INTEGER_OBJ {
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return v.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return v.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
+}
+
+func (v *VM) executeBitNotOperator() error {
+	operand := v.pop()
+
+	integer, ok := operand.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("unsupported type for bitwise not: %s", operand.Type())
+	}
+	return v.push(&object.Integer{Value: ^integer.Value})
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+// integerPower raises base to a non-negative exponent by repeated squaring,
+// wrapping on overflow like the other integer operators.
+func integerPower(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func isNumeric(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
 
-	value := operand.(*object.Integer).Value
-	return v.push(&object.Integer{Value: -value})
+// toFloat widens a numeric object to a float64
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
 }
 
 func isTruthy(obj object.Object) bool {
@@ -509,7 +1090,7 @@ func (v *VM) pop() object.Object {
 
 func (v *VM) push(obj object.Object) error {
 	if v.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return &LimitError{Kind: LimitStack, Message: "stack overflow"}
 	}
 	v.stack[v.sp] = obj
 	v.sp++
@@ -523,9 +1104,14 @@ func (v *VM) pushClosure(constIndex int, numFree int) error {
 		return fmt.Errorf("Not a function: %+v", constant)
 	}
 
-	free := make([]object.Object, numFree)
+	free := make([]*object.Cell, numFree)
 	for i := 0; i < numFree; i++ {
-		free[i] = v.stack[v.sp-numFree+i]
+		captured := v.stack[v.sp-numFree+i]
+		if cell, ok := captured.(*object.Cell); ok {
+			free[i] = cell
+		} else {
+			free[i] = &object.Cell{Value: captured}
+		}
 	}
 	v.sp = v.sp - numFree
 	closure := &object.Closure{Fn: function, Free: free}
@@ -536,9 +1122,16 @@ func (v *VM) currentFrame() *Frame {
 	return v.frames[v.framesIndex-1]
 }
 
-func (v *VM) pushFrame(f *Frame) {
+func (v *VM) pushFrame(f *Frame) error {
+	if v.framesIndex >= v.maxFrames() {
+		return &LimitError{
+			Kind:    LimitFrames,
+			Message: fmt.Sprintf("frame overflow: more than %d nested calls", v.maxFrames()),
+		}
+	}
 	v.frames[v.framesIndex] = f
 	v.framesIndex++
+	return nil
 }
 
 func (v *VM) popFrame() *Frame {
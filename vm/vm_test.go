@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gilmae/monkey/ast"
@@ -25,6 +27,79 @@ func TestArrayLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestAssignStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let f = fn() { a = a + 1; }; f(); f(); a", 3},
+		{"let f = fn() { let a = 1; a = a * 5; a }; f()", 5},
+		{"let f = fn(a) { a = a * 2; a }; f(3)", 6},
+		{
+			input: `
+			let counter = fn() {
+				let count = 0;
+				fn() { count = count + 1; count };
+			};
+			let c = counter();
+			c();
+			c();
+			c();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let pair = fn() {
+				let value = 0;
+				let get = fn() { value };
+				let set = fn(v) { value = v };
+				set(10);
+				get();
+			};
+			pair();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let outer = fn() {
+				let n = 1;
+				let inc = fn() { fn() { n = n + 1 } };
+				inc()();
+				inc()();
+				n;
+			};
+			outer();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let f = fn() {
+				let x = 1;
+				let g = fn() { x };
+				x = 2;
+				g();
+			};
+			f();
+			`,
+			expected: 2,
+		},
+		{
+			input: `
+			let mk = fn() { let a = 1; fn() { a } };
+			let g = mk();
+			let h = fn() { let b = 5; b };
+			h();
+			g();
+			`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -70,23 +145,70 @@ func TestBooleanExpression(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestIntegerOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"2 ** -1", 0.5},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 << 64", 0},
+		{"1 + 2 << 3", 24},
+		{"5 & 1 == 1", true},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 0.5 > 1.41", true},
+		{"9 ** 0.5", 3.0},
+	}
+
+	runVmTests(t, tests)
+
+	errors := []vmTestCase{
+		{"1 / 0", "division by zero"},
+		{"let zero = 0; 10 % zero", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1.5 & 1", "unsupported types for binary operation: FLOAT INTEGER"},
+		{"~1.5", "unsupported type for bitwise not: FLOAT"},
+	}
+	runVmErrorTests(t, errors)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || false", false},
+		{"false || true", true},
+		{"true || false", true},
+		{"1 && \"a\"", true},
+		{"first([]) || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"true and false or false", false},
+		{"let boom = fn() { throw \"evaluated\" }; false && boom()", false},
+		{"let boom = fn() { throw \"evaluated\" }; true || boom()", true},
+		{"let n = 0; let bump = fn() { n = n + 1; true }; bump() && bump() || bump(); n", 2},
+		{"let f = fn(x) { x > 0 && x < 10 }; [f(5), f(0), f(10)]", []interface{}{true, false, false}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{
-			`len("one","two")`,
-			&object.Error{
-				Message: "wrong number of arguments. got=2, want=1",
-			},
-		},
 		{`len([])`, 0},
 		{`len([1,2,3])`, 3},
 		{`puts("hello","world")`, Null},
@@ -94,43 +216,307 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`first([])`, Null},
 		{`first("")`, Null},
 		{`first("Zed")`, "Z"},
-		{
-			`first(1)`,
-			&object.Error{Message: "argument to `first` not supported, got INTEGER"},
-		},
 		{`last([1,2,3])`, 3},
 		{`last([])`, Null},
 		{`last("")`, Null},
 		{`last("Zed")`, "d"},
-		{
-			`last(1)`,
-			&object.Error{Message: "argument to `last` not supported, got INTEGER"},
-		},
 		{`rest([1,2,3])`, []int{2, 3}},
 		{`rest([])`, Null},
 		{`rest("")`, Null},
 		{`rest("Zed")`, "ed"},
-		{
-			`rest(1)`,
-			&object.Error{Message: "argument to `rest` not supported, got INTEGER"},
-		},
 		{`init([1,2,3])`, []int{1, 2}},
 		{`init([])`, Null},
 		{`init("")`, Null},
 		{`init("Zed")`, "Ze"},
-		{
-			`init(1)`,
-			&object.Error{Message: "argument to `init` not supported, got INTEGER"},
-		},
 		{`push([],1)`, []int{1}},
-		{
-			`push(1,1)`,
-			&object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"},
-		},
 	}
 	runVmTests(t, tests)
 }
 
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,c", ",")`, []interface{}{"a", "b", "c"}},
+		{`split("abc", "")`, []interface{}{"a", "b", "c"}},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([], "-")`, ""},
+		{`trim("  monkey \n")`, "monkey"},
+		{`replace("banana", "a", "o")`, "bonono"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "ape")`, false},
+		{`index_of("monkey", "key")`, 3},
+		{`index_of("monkey", "ape")`, -1},
+		{`upper("Monkey")`, "MONKEY"},
+		{`lower("Monkey")`, "monkey"},
+		{`starts_with("monkey", "mon")`, true},
+		{`starts_with("monkey", "key")`, false},
+		{`ends_with("monkey", "key")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`substr("monkey", 3)`, "key"},
+		{`substr("monkey", 1, 3)`, "onk"},
+		{`substr("monkey", 4, 10)`, "ey"},
+		{`substr("monkey", 6)`, ""},
+		{`substr("abc", 1, 9223372036854775807)`, "bc"},
+		{`repeat("", 4611686018427387904)`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`if (contains("monkey", "key") == true) { 1 } else { 2 }`, 1},
+	}
+	runVmTests(t, tests)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`json_parse("[1, 2.5, \"a\", true, null]")`, []interface{}{1, 2.5, "a", true, Null}},
+		{`json_parse("{\"a\": {\"b\": [1, 2]}}")["a"]["b"]`, []interface{}{1, 2}},
+		{`json_parse(" 42 ")`, 42},
+		{`json_stringify({"b": [1, 2.5, first([])], "a": "x<y"})`, `{"a":"x<y","b":[1,2.5,null]}`},
+		{`json_stringify([1, {"k": true}], 2)`, "[\n  1,\n  {\n    \"k\": true\n  }\n]"},
+		{`json_stringify([1], "\t")`, "[\n\t1\n]"},
+		{`json_stringify({1: "one"})`, `{"1":"one"}`},
+		{`let s = "{\"n\":[1,\"two\"]}"; json_stringify(json_parse(s)) == s`, true},
+		{`let a = [1]; json_stringify([a, {"x": a}])`, `[[1],{"x":[1]}]`},
+	}
+	runVmTests(t, tests)
+}
+
+func TestJSONBuiltinErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`json_parse("{")`, "invalid JSON: unexpected EOF"},
+		{`json_parse("1 2")`, "invalid JSON: unexpected data after JSON value"},
+		{`json_parse(1)`, "argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_stringify([fn() { 1 }])`, "cannot convert CLOSURE to JSON"},
+		{`json_stringify(len)`, "cannot convert BUILTIN to JSON"},
+		{`let h = {}; h["self"] = h; json_stringify(h)`, "cannot convert cyclic structure to JSON"},
+		{`let b = [1]; b[0] = [b]; json_stringify(b)`, "cannot convert cyclic structure to JSON"},
+		{`json_stringify(1, true)`, "indent given to `json_stringify` must be INTEGER or STRING, got BOOLEAN"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+func TestEnvironmentBuiltins(t *testing.T) {
+	object.ScriptArgs = []string{"-v", "input.txt"}
+	defer func() { object.ScriptArgs = nil }()
+
+	t.Setenv("MONKEY_TEST_HOME", "/home/monkey")
+	t.Setenv("MONKEY_TEST_SET", "")
+
+	tests := []vmTestCase{
+		{`args()`, []interface{}{"-v", "input.txt"}},
+		{`len(args())`, 2},
+		{`getenv("MONKEY_TEST_HOME")`, "/home/monkey"},
+		{`getenv("MONKEY_TEST_UNSET_VARIABLE")`, Null},
+		{`setenv("MONKEY_TEST_SET", "banana"); getenv("MONKEY_TEST_SET")`, "banana"},
+		{`environ()["MONKEY_TEST_HOME"]`, "/home/monkey"},
+	}
+	runVmTests(t, tests)
+
+	errors := []vmTestCase{
+		{`args(1)`, "wrong number of arguments. got=1, want=0"},
+		{`getenv(1)`, "argument to `getenv` must be STRING, got INTEGER"},
+		{`setenv("A")`, "wrong number of arguments. got=1, want=2"},
+		{`exit("1")`, "argument to `exit` must be INTEGER, got STRING"},
+		{`exit(1, 2)`, "wrong number of arguments. got=2, want=0 or 1"},
+	}
+	runVmErrorTests(t, errors)
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`exit()`, 0},
+		{`exit(3); puts("unreachable")`, 3},
+		{`try { exit(2) } catch (e) { 0 }`, 2},
+		{`let f = fn() { while (true) { exit(5) } }; f()`, 5},
+		{`map([1], fn(x) { exit(4) })`, 4},
+		{`try { map([1], fn(x) { exit(6) }) } catch (e) { 0 }`, 6},
+		{`map([7], exit)`, 7},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+
+		exit, ok := err.(*ExitError)
+		if !ok {
+			t.Errorf("expected *ExitError for %q, got %T (%v)", tt.input, err, err)
+			continue
+		}
+
+		if exit.Code != tt.expected {
+			t.Errorf("wrong exit status for %q: want=%d, got=%d", tt.input, tt.expected, exit.Code)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/helpers.mk": `let shout = fn(s) { upper(s) + "!" }`,
+		"lib/strings.mk": `let helpers = import("helpers"); let greet = fn(name) { helpers["shout"]("hello " + name) }; let _secret = 1;`,
+		"counter.mk":     `let count = 0; let next = fn() { count = count + 1; count };`,
+		"fails.mk":       `let x = 1; throw "module failed"`,
+		"vendor/pkg.mk":  `let version = "1.0"`,
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("MONKEY_PATH", filepath.Join(dir, "vendor"))
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := filepath.Rel(cwd, filepath.Join(dir, "counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []vmTestCase{
+		{fmt.Sprintf(`let s = import(%q); s["greet"]("monkey")`, dir+"/lib/strings"), "HELLO MONKEY!"},
+		{fmt.Sprintf(`import(%q)["_secret"]`, dir+"/lib/strings"), Null},
+		{fmt.Sprintf(`let a = import(%q); a["next"](); let b = import(%q); b["next"]()`, dir+"/counter", dir+"/counter.mk"), 2},
+		{fmt.Sprintf(`let f = fn() { import(%q)["next"]() }; f(); f(); f()`, dir+"/counter"), 3},
+		{fmt.Sprintf(`let a = import(%q); a["next"](); let b = import(%q); b["next"]()`, dir+"/counter", relative), 2},
+		{fmt.Sprintf(`try { import(%q) } catch (e) { e }`, dir+"/fails"), "module failed"},
+		{`import("pkg")["version"]`, "1.0"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallbackBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []interface{}{2, 4, 6}},
+		{`map([], fn(x) { x })`, []interface{}{}},
+		{`map(["a", "b"], upper)`, []interface{}{"A", "B"}},
+		{`let k = 10; map([1, 2], fn(x) { x + k })`, []interface{}{11, 12}},
+		{`sort([3, 1.5, 2])`, []interface{}{1.5, 2, 3}},
+		{`sort(["b", "c", "a"])`, []interface{}{"a", "b", "c"}},
+		{`sort([1, 3, 2], fn(a, b) { a > b })`, []interface{}{3, 2, 1}},
+		{`let a = [2, 1]; sort(a); a`, []interface{}{2, 1}},
+		{`map(sort([[2, "b"], [1, "a"]], fn(x, y) { x[0] < y[0] }), fn(p) { p[1] })`, []interface{}{"a", "b"}},
+		{`let f = fn(xs) { map(xs, fn(x) { map([x], fn(y) { y + 1 })[0] }) }; f([1, 2])`, []interface{}{2, 3}},
+		{`try { map([1], fn(x) { throw "bad" }) } catch (e) { e }`, "bad"},
+		{`try { map([1], fn(x) { x + true }) } catch (e) { 0 }; map([1], fn(x) { try { throw x } catch (e) { e + 1 } })`, []interface{}{2}},
+	}
+	runVmTests(t, tests)
+
+	errors := []vmTestCase{
+		{`map([1], fn(x) { x + true })`, "unsupported types for binary operation: INTEGER BOOLEAN"},
+		{`map([1], fn(x, y) { x })`, "wrong number of arguments: want=2, got=1"},
+		{`map([1], 1)`, "calling non-function and non-built-in"},
+		{`sort([1, "a"])`, "cannot compare STRING and INTEGER"},
+		{`sort([2, 1], fn(a, b) { throw "stop" })`, "uncaught exception: stop"},
+	}
+	runVmErrorTests(t, errors)
+}
+
+func TestCall(t *testing.T) {
+	program := parse(`
+	let offset = 100;
+	let add = fn(a, b) { a + b + offset };
+	let fail = fn() { 1 + true };
+	[add, fail]
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	fns := vm.LastPoppedStackElem().(*object.Array).Elements
+	add := fns[0].(*object.Closure)
+	fail := fns[1].(*object.Closure)
+
+	result, err := vm.Call(add, &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testExpectedObject(t, 103, result)
+
+	sp := vm.sp
+	_, err = vm.Call(fail)
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError, got %T (%v)", err, err)
+	}
+	if rerr.Message != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong error message, got %q", rerr.Message)
+	}
+	if vm.sp != sp || vm.framesIndex != 1 {
+		t.Errorf("failed call left the VM in a different state: sp=%d, frames=%d", vm.sp, vm.framesIndex)
+	}
+
+	result, err = vm.Call(add, &object.Integer{Value: 5}, &object.Integer{Value: 5})
+	if err != nil {
+		t.Fatalf("Call after failure failed: %s", err)
+	}
+	testExpectedObject(t, 110, result)
+
+	_, err = vm.Call(add)
+	if err == nil || err.Error() != "wrong number of arguments: want=2, got=0" {
+		t.Errorf("wrong error for bad argument count, got %v", err)
+	}
+}
+
+func TestStringBuiltinErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a")`, "wrong number of arguments. got=1, want=2"},
+		{`split(1, ",")`, "argument 1 to `split` must be STRING, got INTEGER"},
+		{`join(["a", 1], ",")`, "elements given to `join` must be STRING, got INTEGER"},
+		{`join("a", ",")`, "argument 1 to `join` must be ARRAY, got STRING"},
+		{`trim(1)`, "argument to `trim` must be STRING, got INTEGER"},
+		{`replace("a", "b", 1)`, "argument 3 to `replace` must be STRING, got INTEGER"},
+		{`upper([])`, "argument to `upper` must be STRING, got ARRAY"},
+		{`substr("abc", "1")`, "argument 2 to `substr` must be INTEGER, got STRING"},
+		{`substr("abc", 4)`, "start given to `substr` out of range, got 4"},
+		{`substr("abc", 0, -1)`, "length given to `substr` must not be negative, got -1"},
+		{`repeat("a", -1)`, "count given to `repeat` must not be negative, got -1"},
+		{`repeat("ab", 4611686018427387904)`, "result of `repeat` too long: more than 1073741824 bytes"},
+		{`repeat("a", 1073741825)`, "result of `repeat` too long: more than 1073741824 bytes"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one","two")`, "wrong number of arguments. got=2, want=1"},
+		{`first(1)`, "argument to `first` not supported, got INTEGER"},
+		{`last(1)`, "argument to `last` not supported, got INTEGER"},
+		{`rest(1)`, "argument to `rest` not supported, got INTEGER"},
+		{`init(1)`, "argument to `init` not supported, got INTEGER"},
+		{`push(1,1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let a = int("x"); 5`, "string is not an int, got x"},
+		{`let f = fn(a) { len(a) }; f(1)`, "argument to `len` not supported, got INTEGER"},
+	}
+	runVmErrorTests(t, tests)
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -241,6 +627,182 @@ func TestClosures(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i = i + 1 }; i", 10},
+		{"let i = 0; while (false) { i = i + 1 }; i", 0},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{`let s = ""; for (c in "abc") { s = c + s }; s`, "cba"},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { s = s + k }; s`, "ab"},
+		{"let i = 0; while (true) { i = i + 1; if (i == 5) { break } }; i", 5},
+		{"let i = 0; if (true) { while (i < 3) { i = i + 1; } }; i", 3},
+		{"let s = 0; if (false) { 1 } else { for (x in [1, 2]) { s = s + x } }; s", 3},
+		{"let i = 0; if (true) { while (i < 3) { i = i + 1; } }", Null},
+		{"let f = fn() { if (true) { let x = 1; } }; f()", Null},
+		{
+			input: `
+			let sum = 0;
+			for (x in [1, 2, 3, 4, 5, 6]) {
+				if (x == 3) { continue }
+				if (x == 5) { break }
+				sum = sum + x
+			};
+			sum
+			`,
+			expected: 7,
+		},
+		{
+			input: `
+			let count = 0;
+			for (a in [1, 2, 3]) {
+				for (b in [1, 2, 3]) {
+					if (b > a) { break }
+					count = count + 1
+				}
+			};
+			count
+			`,
+			expected: 6,
+		},
+		{
+			input: `
+			let f = fn(n) {
+				let total = 0;
+				let i = 0;
+				while (i < n) {
+					i = i + 1;
+					if (i == 2) { continue }
+					total = total + i
+				}
+				total
+			};
+			f(4)
+			`,
+			expected: 8,
+		},
+		{
+			input: `
+			let find = fn(arr, target) {
+				for (x in arr) {
+					if (x == target) { return true }
+				}
+				false
+			};
+			[find([1, 2, 3], 2), find([1, 2, 3], 4)]
+			`,
+			expected: []interface{}{true, false},
+		},
+		{
+			input: `
+			let i = 0;
+			while (i < 3) {
+				try { i = i + 1; if (i == 2) { break } } catch (e) { 0 }
+			};
+			try { throw i } catch (e) { e * 10 }
+			`,
+			expected: 20,
+		},
+		{"let n = 0; while (n < 5000) { n = n + 1 }; n", 5000},
+		{
+			input: `
+			let n = 0;
+			while (n < 5000) {
+				n = n + 1;
+				while (true) { let x = 1 + (if (true) { break } else { 2 }); }
+			};
+			n
+			`,
+			expected: 5000,
+		},
+		{
+			input: `
+			let arr = [];
+			let i = 0;
+			while (i < 5000) { arr = push(arr, i); i = i + 1 };
+			let m = 0;
+			for (k in arr) { m = m + [1, 2, if (k > 0) { continue } else { 3 }][0]; };
+			m
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let s = 0;
+			for (x in [1, 2, 3]) {
+				s = s + (x * try { if (x == 2) { continue } else { x } } catch (e) { 0 });
+			};
+			try { throw s } catch (e) { e }
+			`,
+			expected: 10,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+			sum(5000, 0)
+			`,
+			expected: 12502500,
+		},
+		{
+			input: `
+			let parity = fn(n, even) { if (n == 0) { return even; } parity(n - 1, !even) };
+			parity(3001, true)
+			`,
+			expected: false,
+		},
+		{
+			input: `
+			let count = fn(n) { if (n == 0) { return len([1, 2]); } return count(n - 1); };
+			count(2000)
+			`,
+			expected: 2,
+		},
+		{
+			input: `
+			let adder = fn(x) { fn(y) { x + y } };
+			let apply = fn(f, v) { f(v) };
+			apply(adder(2), 3)
+			`,
+			expected: 5,
+		},
+		{
+			input: `
+			let g = fn() { throw "boom" };
+			let f = fn() { try { return g(); } catch (e) { "caught " + e } };
+			f()
+			`,
+			expected: "caught boom",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFrameOverflow(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"let f = fn() { f() + 1 }; f()",
+			"frame overflow: more than 1024 nested calls",
+		},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -293,6 +855,31 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"10 / 4.0", 2.5},
+		{"3 - 4.5", -1.5},
+		{"-2.5", -2.5},
+		{"1e3 / 10", 100.0},
+		{"1.5 < 2", true},
+		{"2 <= 1.5", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"2.5 > 2.25", true},
+		{"float(3) / 2", 1.5},
+		{`float("2.5")`, 2.5},
+		{"int(2.9)", 2},
+		{"round(2.5)", 3.0},
+		{"round(3.14159, 2)", 3.14},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestFunctionsWithReturnStatement(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -587,6 +1174,103 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestIndexAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[1] = 5; a", []int{1, 5, 3}},
+		{"let a = [1, 2, 3]; a[0] = a[0] + 10", 11},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {}; h["b"] = 3; h["b"]`, 3},
+		{`let h = {"xs": [1, 2]}; h["xs"][1] = 7; h["xs"]`, []int{1, 7}},
+		{"let a = [1]; let b = a; b[0] = 2; a[0]", 2},
+		{"let f = fn(a) { a[0] = 9 }; let a = [0]; f(a); a[0]", 9},
+		{"let a = [0, 0]; let i = 0; while (i < 2) { a[i] = i + 1; i = i + 1 }; a", []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a += 2; a", 3},
+		{"let a = 10; a -= 4", 6},
+		{"let a = 3; a *= 2 + 1; a", 9},
+		{"let a = 7; a /= 2; a", 3},
+		{"let a = 7; a %= 4; a", 3},
+		{"let a = 1.5; a += 1; a", 2.5},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let total = 0; for (x in [1, 2, 3]) { total += x }; total", 6},
+		{"let f = fn() { let n = 1; n *= 5; n }; f()", 5},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c()", 2},
+		{"let a = [1, 2]; a[1] += 10; a", []int{1, 12}},
+		{`let h = {"n": 2}; h["n"] *= 3; h["n"]`, 6},
+		{`let h = {"xs": [5]}; h["xs"][0] -= 1; h["xs"]`, []int{4}},
+		{
+			input: `
+			let calls = 0;
+			let i = fn() { calls += 1; 0 };
+			let a = [1];
+			a[i()] += 1;
+			[a[0], calls]
+			`,
+			expected: []int{2, 1},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 1; i++", 1},
+		{"let i = 1; i++; i", 2},
+		{"let i = 1; ++i", 2},
+		{"let i = 1; i--; i", 0},
+		{"let i = 1; --i", 0},
+		{"let i = 1.5; i++; i", 2.5},
+		{"let i = 0; while (i < 5) { i++ }; i", 5},
+		{"let f = fn() { let n = 0; n++; n++ }; f()", 1},
+		{"let counter = fn() { let n = 0; fn() { ++n } }; let c = counter(); c(); c()", 2},
+		{"let a = [1, 2]; a[1]++", 2},
+		{"let a = [1, 2]; a[1]++; a", []int{1, 3}},
+		{"let a = [1, 2]; --a[0]; a", []int{0, 2}},
+		{`let h = {"n": 1}; h["n"]++ + h["n"]++`, 3},
+		{`let h = {"n": 1}; h["n"]++; h["n"]++; h["n"]`, 3},
+		{"let f = fn(a) { a[0]++; a[0]++ }; f([5])", 6},
+		{"let a = [0, 0]; let i = 0; a[i++]++; [a, i]", []interface{}{[]interface{}{1, 0}, 1}},
+	}
+
+	runVmTests(t, tests)
+
+	errors := []vmTestCase{
+		{`let s = "a"; s++`, "unsupported types for binary operation: STRING INTEGER"},
+		{"let a = [1]; a[2]++", "unsupported types for binary operation: NULL INTEGER"},
+	}
+
+	runVmErrorTests(t, errors)
+}
+
+func TestCompoundAssignmentErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a /= 0", "division by zero"},
+		{"let a = [1]; a[3] += 1", "unsupported types for binary operation: NULL INTEGER"},
+		{"let a = true; a += 1", "unsupported types for binary operation: BOOLEAN INTEGER"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1]; a[1] = 2", "index out of range: 1, length 1"},
+		{"let a = [1]; a[-1] = 2", "index out of range: -1, length 1"},
+		{`let a = [1]; a["x"] = 2`, "index into ARRAY must be INTEGER, got STRING"},
+		{"let h = {}; h[fn() { 1 }] = 2", "unusable as hash key: CLOSURE"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []vmTestCase{
 		{"1", 1},
@@ -605,6 +1289,69 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestUnknownOpcode(t *testing.T) {
+	vm := New(&compiler.Bytecode{Instructions: []byte{255}})
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError, got %T (%+v)", err, err)
+	}
+
+	if rerr.Message != "unknown opcode 255" {
+		t.Errorf("wrong message, want=%q, got=%q", "unknown opcode 255", rerr.Message)
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	input := `
+	let inner = fn() { 1 + true };
+	let outer = fn() { let result = inner(); result };
+	outer();
+	`
+	program := parse(input)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError, got %T (%+v)", err, err)
+	}
+
+	expectedMessage := "unsupported types for binary operation: INTEGER BOOLEAN"
+	if rerr.Message != expectedMessage {
+		t.Errorf("wrong message, want=%q, got=%q", expectedMessage, rerr.Message)
+	}
+
+	expectedFunctions := []string{"inner", "outer", "<main>"}
+	if len(rerr.Trace) != len(expectedFunctions) {
+		t.Fatalf("wrong trace length, want=%d, got=%d (%+v)", len(expectedFunctions), len(rerr.Trace), rerr.Trace)
+	}
+
+	expectedLines := []int{2, 3, 4}
+	for i, name := range expectedFunctions {
+		if rerr.Trace[i].Function != name {
+			t.Errorf("trace[%d] wrong function, want=%q, got=%q", i, name, rerr.Trace[i].Function)
+		}
+		if rerr.Trace[i].Pos.Line != expectedLines[i] {
+			t.Errorf("trace[%d] wrong line, want=%d, got=%d", i, expectedLines[i], rerr.Trace[i].Pos.Line)
+		}
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
@@ -614,6 +1361,56 @@ func TestStringExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []vmTestCase{
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"b" > "a"`, true},
+		{`"a" <= "a"`, true},
+		{`"a" >= "b"`, false},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"monkey" != "monkey"`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e + 1 }", 6},
+		{`try { int("x") } catch (e) { 7 }`, 7},
+		{`try { len(1) } catch (e) { e }`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`let f = fn() { throw "boom" }; try { f() } catch (e) { e }`, "boom"},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+		{"let a = 1 + try { throw 1 } catch (e) { 10 }; a", 11},
+		{"let f = fn() { throw 4 }; [1, try { [3, f()] } catch (e) { e }]", []int{1, 4}},
+		{"let f = fn() { try { return 1 } catch (e) { 2 } }; f(); try { throw 3 } catch (e) { e }", 3},
+		{"try { } catch (e) { 1 }", Null},
+		{"try { throw 1 } catch (e) { }", Null},
+		{
+			input: `
+			let g = fn(x) { if (x == 0) { throw "bottom" } else { g(x - 1) } };
+			let f = fn() { try { g(10) } catch (e) { e + "!" } };
+			f();
+			`,
+			expected: "bottom!",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{"throw 4", "uncaught exception: 4"},
+		{`throw "x"`, "uncaught exception: x"},
+		{"let f = fn() { try { return 1 } catch (e) { 2 } }; f(); throw 4", "uncaught exception: 4"},
+		{"try { len(1) } catch (e) { throw e }", "argument to `len` not supported, got INTEGER"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestUseExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{`use("foobar")`, Null},
@@ -661,6 +1458,32 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
+// runVmErrorTests runs each input expecting the VM to fail with the given
+// error message.
+func runVmErrorTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error for %q but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -717,6 +1540,31 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			}
 		}
 
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
+	case []interface{}:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+
+		for i, el := range expected {
+			testExpectedObject(t, el, array.Elements[i])
+		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("object is not Null: %T (%+v)", actual, actual)
@@ -767,3 +1615,31 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+
+	if !ok {
+		return fmt.Errorf("object is not String, got %T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value, expected %q, got %q", expected, result.Value)
+	}
+
+	return nil
+}
+
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+
+	if !ok {
+		return fmt.Errorf("object is not Float, got %T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value, expected %g, got %g", expected, result.Value)
+	}
+
+	return nil
+}